@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+)
+
+// client certificate verification modes
+const (
+	// ClientAuthRequire requires a verified client certificate from every TLS connection
+	ClientAuthRequire = "require"
+	// ClientAuthVerifyIfGiven verifies client certificates when the client sends one
+	ClientAuthVerifyIfGiven = "verify_if_given"
+)
+
+// TLSClientAuth defines the client certificate authentication of TLS connections
+type TLSClientAuth struct {
+	// require or verify_if_given
+	Mode string `yaml:"mode"`
+	// path of the PEM encoded CA bundle verifying client certificates
+	CAFile string `yaml:"ca_file"`
+	// maps verified client certificates to scopes
+	Identities []CertIdentity `yaml:"identities"`
+}
+
+// CertIdentity grants scopes to client certificates
+// a certificate matches when all set fields match,
+// it's granted the scopes of all identities it matches
+type CertIdentity struct {
+	// subject fields
+	CommonName         string `yaml:"common_name"`
+	Organization       string `yaml:"organization"`
+	OrganizationalUnit string `yaml:"organizational_unit"`
+	// subject alternative names
+	DNSName string `yaml:"dns_name"`
+	URI     string `yaml:"uri"`
+	Email   string `yaml:"email"`
+
+	// scopes granted, in the itsyou.online JWT scope format (e.g.: zedis_org.zedis_namespace.read)
+	Scopes []string `yaml:"scopes"`
+}
+
+// validateTLSClientAuth checks the client certificate authentication config
+func validateTLSClientAuth(zc *Zedis) error {
+	ca := zc.TLSClientAuth
+	if ca == nil {
+		return nil
+	}
+	if ca.Mode != ClientAuthRequire && ca.Mode != ClientAuthVerifyIfGiven {
+		return fmt.Errorf("invalid tls_client_auth mode %q: should be %s or %s", ca.Mode, ClientAuthRequire, ClientAuthVerifyIfGiven)
+	}
+	if ca.CAFile == "" {
+		return fmt.Errorf("tls_client_auth has no ca_file")
+	}
+	for i, identity := range ca.Identities {
+		if !identity.hasMatchFields() {
+			return fmt.Errorf("tls_client_auth identity %d matches every certificate: set at least one field to match", i)
+		}
+		if len(identity.Scopes) == 0 {
+			return fmt.Errorf("tls_client_auth identity %d has no scopes", i)
+		}
+	}
+	return nil
+}
+
+func (ci CertIdentity) hasMatchFields() bool {
+	return ci.CommonName != "" || ci.Organization != "" || ci.OrganizationalUnit != "" ||
+		ci.DNSName != "" || ci.URI != "" || ci.Email != ""
+}
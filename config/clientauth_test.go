@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTLSClientAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	zc := Zedis{}
+	assert.NoError(validateTLSClientAuth(&zc), "client auth is optional")
+
+	zc.TLSClientAuth = &TLSClientAuth{
+		Mode:   ClientAuthRequire,
+		CAFile: "ca.pem",
+		Identities: []CertIdentity{
+			{CommonName: "backup", Scopes: []string{"org.ns.read"}},
+		},
+	}
+	assert.NoError(validateTLSClientAuth(&zc))
+
+	zc.TLSClientAuth.Mode = "sometimes"
+	assert.Error(validateTLSClientAuth(&zc), "invalid mode")
+	zc.TLSClientAuth.Mode = ClientAuthVerifyIfGiven
+
+	zc.TLSClientAuth.Identities = append(zc.TLSClientAuth.Identities, CertIdentity{Scopes: []string{"org.ns"}})
+	assert.Error(validateTLSClientAuth(&zc), "identity without match fields")
+
+	zc.TLSClientAuth.Identities[1] = CertIdentity{Email: "ops@zedis.org"}
+	assert.Error(validateTLSClientAuth(&zc), "identity without scopes")
+
+	zc.TLSClientAuth.Identities = nil
+	zc.TLSClientAuth.CAFile = ""
+	assert.Error(validateTLSClientAuth(&zc), "missing CA file")
+}
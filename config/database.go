@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zero-os/0-stor/client"
+)
+
+// Database defines a numbered database stored in its own 0-stor namespace
+// unset fields fall back to the main config
+type Database struct {
+	// Number used to SELECT the database, 0 is the main namespace and can't be used
+	Index int `yaml:"index"`
+
+	// itsyou.online organization a JWT needs scopes of to access the database
+	JWTOrganization string `yaml:"jwt_organization"`
+	// itsyou.online namespace a JWT needs scopes of to access the database
+	// defaults to the 0-stor namespace of the database
+	JWTNamespace string `yaml:"jwt_namespace"`
+
+	// 0-stor namespace of the database, required
+	Namespace string `yaml:"namespace"`
+
+	// 0-stor policy overrides
+	PolicyOverrides `yaml:",inline"`
+}
+
+// Database returns the database with given index
+func (zc *Zedis) Database(index int) (Database, bool) {
+	for _, db := range zc.Databases {
+		if db.Index == index {
+			return db, true
+		}
+	}
+	return Database{}, false
+}
+
+// DatabaseExists returns true if a database can be selected
+func (zc *Zedis) DatabaseExists(index int) bool {
+	if index == 0 {
+		return true
+	}
+	_, ok := zc.Database(index)
+	return ok
+}
+
+// DatabaseJWTScope returns the itsyou.online organization and namespace
+// a JWT needs scopes of to access a database
+func (zc *Zedis) DatabaseJWTScope(index int) (string, string) {
+	db, ok := zc.Database(index)
+	if index == 0 || !ok {
+		return zc.JWTOrganization, zc.JWTNamespace
+	}
+
+	organization := db.JWTOrganization
+	if organization == "" {
+		organization = zc.JWTOrganization
+	}
+	namespace := db.JWTNamespace
+	if namespace == "" {
+		namespace = db.Namespace
+	}
+	return organization, namespace
+}
+
+// DatabaseStorPolicy returns the 0-stor policy of a database
+func (zc *Zedis) DatabaseStorPolicy(db Database) client.Policy {
+	policy := db.apply(zc.StorPolicy())
+	policy.Namespace = db.Namespace
+	return policy
+}
+
+// PolicyOverrides defines 0-stor policy fields overriding the main config
+// unset fields keep the value of the main config
+type PolicyOverrides struct {
+	// ItsYouOnline organization of the namespace used
+	Organization string `yaml:"organization"`
+
+	// ItsYouOnline oauth2 application ID
+	IYOAppID string `yaml:"iyo_app_id"`
+	// ItsYouOnline oauth2 application secret
+	IYOSecret string `yaml:"iyo_app_secret"`
+
+	// Addresses to the 0-stor used to store date
+	DataShards []string `yaml:"data_shards"`
+	// Addresses of the etcd cluster
+	MetaShards []string `yaml:"meta_shards"`
+
+	BlockSize              *int    `yaml:"block_size"`
+	ReplicationNr          *int    `yaml:"replication_nr"`
+	ReplicationMaxSize     *int    `yaml:"replication_max_size"`
+	DistributionNr         *int    `yaml:"distribution_data"`
+	DistributionRedundancy *int    `yaml:"distribution_parity"`
+	Compress               *bool   `yaml:"compress"`
+	Encrypt                *bool   `yaml:"encrypt"`
+	EncryptKey             *string `yaml:"encrypt_key"`
+}
+
+// apply returns the policy with the set overrides
+func (po PolicyOverrides) apply(policy client.Policy) client.Policy {
+	if po.Organization != "" {
+		policy.Organization = po.Organization
+	}
+	if po.IYOAppID != "" {
+		policy.IYOAppID = po.IYOAppID
+	}
+	if po.IYOSecret != "" {
+		policy.IYOSecret = po.IYOSecret
+	}
+	if len(po.DataShards) > 0 {
+		policy.DataShards = po.DataShards
+	}
+	if len(po.MetaShards) > 0 {
+		policy.MetaShards = po.MetaShards
+	}
+	if po.BlockSize != nil {
+		policy.BlockSize = *po.BlockSize
+	}
+	if po.ReplicationNr != nil {
+		policy.ReplicationNr = *po.ReplicationNr
+	}
+	if po.ReplicationMaxSize != nil {
+		policy.ReplicationMaxSize = *po.ReplicationMaxSize
+	}
+	if po.DistributionNr != nil {
+		policy.DistributionNr = *po.DistributionNr
+	}
+	if po.DistributionRedundancy != nil {
+		policy.DistributionRedundancy = *po.DistributionRedundancy
+	}
+	if po.Compress != nil {
+		policy.Compress = *po.Compress
+	}
+	if po.Encrypt != nil {
+		policy.Encrypt = *po.Encrypt
+	}
+	if po.EncryptKey != nil {
+		policy.EncryptKey = *po.EncryptKey
+	}
+
+	return policy
+}
+
+// validateDatabases checks if the databases have a unique index and a namespace
+func validateDatabases(zc *Zedis) error {
+	indexes := make(map[int]struct{}, len(zc.Databases))
+	for _, db := range zc.Databases {
+		if db.Index <= 0 {
+			return fmt.Errorf("invalid database index %d: should be bigger than 0", db.Index)
+		}
+		if _, ok := indexes[db.Index]; ok {
+			return fmt.Errorf("database %d is defined more than once", db.Index)
+		}
+		indexes[db.Index] = struct{}{}
+
+		if db.Namespace == "" {
+			return fmt.Errorf("database %d has no namespace", db.Index)
+		}
+	}
+	return nil
+}
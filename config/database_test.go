@@ -0,0 +1,85 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabaseStorPolicy(t *testing.T) {
+	assert := assert.New(t)
+	blockSize := 0
+	encrypt := false
+	zc := Zedis{
+		Organization: "org",
+		Namespace:    "ns",
+		DataShards:   []string{"127.0.0.1:12345"},
+		BlockSize:    4096,
+		Encrypt:      true,
+		EncryptKey:   "ab345678901234567890123456789012",
+	}
+	db := Database{
+		Index:     1,
+		Namespace: "ns1",
+		PolicyOverrides: PolicyOverrides{
+			DataShards: []string{"127.0.0.1:22345"},
+			BlockSize:  &blockSize,
+			Encrypt:    &encrypt,
+		},
+	}
+
+	policy := zc.DatabaseStorPolicy(db)
+	assert.Equal("org", policy.Organization)
+	assert.Equal("ns1", policy.Namespace)
+	assert.Equal([]string{"127.0.0.1:22345"}, policy.DataShards)
+	assert.Equal(0, policy.BlockSize, "explicit zero value should override")
+	assert.False(policy.Encrypt)
+	assert.Equal(zc.EncryptKey, policy.EncryptKey)
+
+	// main config is untouched
+	assert.Equal("ns", zc.StorPolicy().Namespace)
+}
+
+func TestDatabaseJWTScope(t *testing.T) {
+	assert := assert.New(t)
+	zc := Zedis{
+		JWTOrganization: "org",
+		JWTNamespace:    "ns",
+		Databases: []Database{
+			{Index: 1, Namespace: "ns1"},
+			{Index: 2, Namespace: "ns2", JWTOrganization: "org2", JWTNamespace: "jwtns2"},
+		},
+	}
+
+	org, ns := zc.DatabaseJWTScope(0)
+	assert.Equal("org", org)
+	assert.Equal("ns", ns)
+
+	org, ns = zc.DatabaseJWTScope(1)
+	assert.Equal("org", org)
+	assert.Equal("ns1", ns)
+
+	org, ns = zc.DatabaseJWTScope(2)
+	assert.Equal("org2", org)
+	assert.Equal("jwtns2", ns)
+
+	assert.True(zc.DatabaseExists(0))
+	assert.True(zc.DatabaseExists(2))
+	assert.False(zc.DatabaseExists(3))
+}
+
+func TestValidateDatabases(t *testing.T) {
+	assert := assert.New(t)
+
+	zc := Zedis{Databases: []Database{{Index: 1, Namespace: "ns1"}, {Index: 3, Namespace: "ns3"}}}
+	assert.NoError(validateDatabases(&zc))
+
+	zc = Zedis{Databases: []Database{{Index: 0, Namespace: "ns0"}}}
+	assert.Error(validateDatabases(&zc), "database 0 is reserved")
+
+	zc = Zedis{Databases: []Database{{Index: 1, Namespace: "ns1"}, {Index: 1, Namespace: "ns2"}}}
+	assert.Error(validateDatabases(&zc), "duplicate index")
+
+	zc = Zedis{Databases: []Database{{Index: 1}}}
+	assert.Error(validateDatabases(&zc), "missing namespace")
+}
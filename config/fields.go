@@ -0,0 +1,84 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// fields derived from a config field when the config is loaded, by YAML name of the config field
+var derivedFields = map[string][]string{
+	"auth_commands":             {"AuthCommands", "AuthAll"},
+	"unix_socket_perm":          {"UnixSocketPermMode"},
+	"unix_socket_auth_commands": {"UnixSocketAuthCommands", "UnixSocketAuthAll"},
+	"tls_min_version":           {"TLSMinVersionID"},
+	"tls_cipher_suites":         {"TLSCipherSuiteIDs"},
+}
+
+// FieldNames returns the YAML names of the config fields, in the order they are defined
+func FieldNames() []string {
+	t := reflect.TypeOf(Zedis{})
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name := yamlName(t.Field(i)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// HasField returns true if the config has a field with given YAML name
+func HasField(name string) bool {
+	_, ok := fieldByYAMLName(name)
+	return ok
+}
+
+// ChangedFields returns the YAML names of the config fields that differ between 2 configs
+func ChangedFields(a, b *Zedis) []string {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	var changed []string
+	for i := 0; i < va.NumField(); i++ {
+		name := yamlName(va.Type().Field(i))
+		if name == "" {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// CopyFields copies the config fields with given YAML names, and the fields derived from them, from src to dst
+func CopyFields(dst, src *Zedis, names []string) {
+	vdst, vsrc := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for _, name := range names {
+		field, ok := fieldByYAMLName(name)
+		if !ok {
+			continue
+		}
+		vdst.FieldByIndex(field.Index).Set(vsrc.FieldByIndex(field.Index))
+		for _, derived := range derivedFields[name] {
+			vdst.FieldByName(derived).Set(vsrc.FieldByName(derived))
+		}
+	}
+}
+
+// fieldByYAMLName returns the config field with given YAML name
+func fieldByYAMLName(name string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(Zedis{})
+	for i := 0; i < t.NumField(); i++ {
+		if yamlName(t.Field(i)) == name {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// yamlName returns the YAML name of a config field, empty when it's not read from YAML
+func yamlName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldNames(t *testing.T) {
+	assert := assert.New(t)
+	names := FieldNames()
+	assert.Equal("port", names[0])
+	assert.Contains(names, "auth_commands")
+	assert.Contains(names, "encrypt_key")
+	assert.NotContains(names, "", "derived fields are not read from YAML")
+}
+
+func TestChangedAndCopyFields(t *testing.T) {
+	assert := assert.New(t)
+
+	a := &Zedis{Port: ":6380", AuthCommandsInput: "set", DataShards: []string{"127.0.0.1:12345"}}
+	parseAuthCommands(a)
+	b := &Zedis{Port: ":6390", AuthCommandsInput: "all", DataShards: []string{"127.0.0.1:12345"}, Path: "other.yaml"}
+	parseAuthCommands(b)
+
+	assert.Equal([]string{"port", "auth_commands"}, ChangedFields(a, b))
+
+	CopyFields(a, b, []string{"auth_commands", "unknown"})
+	assert.Equal(":6380", a.Port)
+	assert.Equal("all", a.AuthCommandsInput)
+	assert.True(a.AuthAll, "derived fields should be copied")
+	assert.Equal(b.AuthCommands, a.AuthCommands)
+	assert.Equal([]string{"port"}, ChangedFields(a, b))
+}
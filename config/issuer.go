@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+)
+
+// JWTIssuer defines an issuer trusted to sign JWTs
+type JWTIssuer struct {
+	// expected iss claim of the JWTs, not checked when empty
+	Issuer string `yaml:"issuer"`
+	// expected aud claim of the JWTs, not checked when empty
+	Audience string `yaml:"audience"`
+	// allowed signing algorithms (ES256, ES384, ES512, RS256, RS384, RS512 or EdDSA)
+	// all of them are allowed when empty
+	Algorithms []string `yaml:"algorithms"`
+
+	// PEM encoded public keys
+	PublicKeys []string `yaml:"public_keys"`
+	// paths of files with PEM encoded public keys
+	PublicKeyFiles []string `yaml:"public_key_files"`
+	// path of a JSON Web Key Set file
+	JWKSFile string `yaml:"jwks_file"`
+}
+
+// validateJWTIssuers checks if the issuers have keys
+// the keys themselves are parsed when the server starts
+func validateJWTIssuers(zc *Zedis) error {
+	for i, issuer := range zc.JWTIssuers {
+		if len(issuer.PublicKeys) == 0 && len(issuer.PublicKeyFiles) == 0 && issuer.JWKSFile == "" {
+			return fmt.Errorf("jwt issuer %d (%s) has no public_keys, public_key_files or jwks_file", i, issuer.Issuer)
+		}
+	}
+	return nil
+}
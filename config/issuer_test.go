@@ -0,0 +1,24 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateJWTIssuers(t *testing.T) {
+	assert := assert.New(t)
+
+	zc := Zedis{}
+	assert.NoError(validateJWTIssuers(&zc), "issuers are optional")
+
+	zc.JWTIssuers = []JWTIssuer{
+		{Issuer: "pem", PublicKeys: []string{"a key"}},
+		{Issuer: "file", PublicKeyFiles: []string{"key.pem"}},
+		{Issuer: "jwks", JWKSFile: "keys.json"},
+	}
+	assert.NoError(validateJWTIssuers(&zc))
+
+	zc.JWTIssuers = append(zc.JWTIssuers, JWTIssuer{Issuer: "nokeys"})
+	assert.Error(validateJWTIssuers(&zc))
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// default maximum amount of connected clients
+	defaultMaxClients = 10000
+	// default seconds between TCP keepalive probes
+	defaultTCPKeepAlive = 300
+	// default milliseconds a command may wait for the 0-stor
+	defaultCommandTimeout = 30000
+)
+
+// RateLimit defines a token bucket limiting the commands of a category
+type RateLimit struct {
+	// commands allowed per second
+	Rate float64 `yaml:"rate"`
+	// commands allowed at once, after being idle
+	// defaults to the rate rounded up
+	Burst int `yaml:"burst"`
+}
+
+// validateLimits checks the connection limits and normalizes the rate limits
+func validateLimits(zc *Zedis) error {
+	if zc.MaxClients < 0 {
+		return fmt.Errorf("invalid maxclients %d: can't be negative", zc.MaxClients)
+	}
+	if zc.MaxClientsPerIP < 0 {
+		return fmt.Errorf("invalid maxclients_per_ip %d: can't be negative", zc.MaxClientsPerIP)
+	}
+
+	if zc.RateLimits == nil {
+		return nil
+	}
+	limits := make(map[string]RateLimit, len(zc.RateLimits))
+	for category, limit := range zc.RateLimits {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if !strings.HasPrefix(category, "@") || len(category) == 1 {
+			return fmt.Errorf("invalid rate_limits category %q: should start with a '@'", category)
+		}
+		if limit.Rate <= 0 {
+			return fmt.Errorf("invalid rate of %s in rate_limits: should be positive", category)
+		}
+		if limit.Burst < 0 {
+			return fmt.Errorf("invalid burst of %s in rate_limits: can't be negative", category)
+		}
+		if limit.Burst == 0 {
+			limit.Burst = int(math.Ceil(limit.Rate))
+		}
+		limits[category] = limit
+	}
+	zc.RateLimits = limits
+	return nil
+}
+
+// validateTimeouts checks the connection and command timeouts
+func validateTimeouts(zc *Zedis) error {
+	if zc.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %d: can't be negative", zc.Timeout)
+	}
+	if zc.TCPKeepAlive < 0 {
+		return fmt.Errorf("invalid tcp_keepalive %d: can't be negative", zc.TCPKeepAlive)
+	}
+	if zc.CommandTimeout < 0 {
+		return fmt.Errorf("invalid command_timeout %d: can't be negative", zc.CommandTimeout)
+	}
+	return nil
+}
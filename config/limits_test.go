@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	zc := Zedis{}
+	assert.NoError(validateLimits(&zc), "limits are optional")
+
+	zc.RateLimits = map[string]RateLimit{
+		" @Write": {Rate: 10, Burst: 50},
+		"@read":   {Rate: 2.5},
+	}
+	assert.NoError(validateLimits(&zc))
+	assert.Equal(map[string]RateLimit{
+		"@write": {Rate: 10, Burst: 50},
+		"@read":  {Rate: 2.5, Burst: 3},
+	}, zc.RateLimits, "categories are normalized, burst defaults to the rate")
+
+	zc.RateLimits = map[string]RateLimit{"write": {Rate: 10}}
+	assert.Error(validateLimits(&zc), "category without @")
+	zc.RateLimits = map[string]RateLimit{"@write": {}}
+	assert.Error(validateLimits(&zc), "missing rate")
+	zc.RateLimits = map[string]RateLimit{"@write": {Rate: 1, Burst: -1}}
+	assert.Error(validateLimits(&zc), "negative burst")
+	zc.RateLimits = nil
+
+	zc.MaxClients = -1
+	assert.Error(validateLimits(&zc), "negative maxclients")
+	zc.MaxClients = 0
+	zc.MaxClientsPerIP = -1
+	assert.Error(validateLimits(&zc), "negative maxclients_per_ip")
+}
+
+func TestValidateTimeouts(t *testing.T) {
+	assert := assert.New(t)
+
+	zc := Zedis{Timeout: 300, TCPKeepAlive: 60, CommandTimeout: 5000}
+	assert.NoError(validateTimeouts(&zc))
+	assert.NoError(validateTimeouts(&Zedis{}), "0 disables the timeouts")
+
+	zc.Timeout = -1
+	assert.Error(validateTimeouts(&zc), "negative timeout")
+	zc.Timeout = 0
+	zc.TCPKeepAlive = -1
+	assert.Error(validateTimeouts(&zc), "negative tcp_keepalive")
+	zc.TCPKeepAlive = 0
+	zc.CommandTimeout = -1
+	assert.Error(validateTimeouts(&zc), "negative command_timeout")
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// names of the listeners configured by port, tls_port and unix_socket
+var reservedListenerNames = map[string]bool{
+	"plain": true,
+	"tls":   true,
+	"unix":  true,
+}
+
+// Listener defines an interface Redis is served on, along with its policy
+type Listener struct {
+	// name of the listener in logs and metrics, the address when empty
+	Name string `yaml:"name"`
+	// tcp (default), tcp4, tcp6 or unix
+	Network string `yaml:"network"`
+	// host:port of a TCP listener or path of a Unix socket
+	Address string `yaml:"address"`
+	// serve TLS, with the certificates and settings of the TLS port
+	TLS bool `yaml:"tls"`
+	// octal permissions of a Unix socket (e.g. 770), the umask decides when empty
+	Perm string `yaml:"perm"`
+	// Parsed Perm
+	PermMode os.FileMode `yaml:"-"`
+	// expect a PROXY protocol v1 or v2 header, sent by a load balancer, on every connection
+	ProxyProtocol bool `yaml:"proxy_protocol"`
+
+	// commands that require authentication, in the format of auth_commands
+	// auth_commands is used when empty
+	AuthCommandsInput string `yaml:"auth_commands"`
+	// Parsed AuthCommandsInput, nil when empty
+	AuthCommands map[string]struct{} `yaml:"-"`
+	// Set when all commands require authentication
+	AuthAll bool `yaml:"-"`
+
+	// commands (e.g. get) and command categories (e.g. @read) allowed on the listener
+	// all commands are allowed when empty
+	Commands []string `yaml:"commands"`
+	// refuse commands that write
+	ReadOnly bool `yaml:"read_only"`
+
+	// IP addresses and CIDR ranges (e.g. 10.0.0.0/8) of the clients allowed to connect
+	// all clients are allowed when empty
+	Allow []string `yaml:"allow"`
+	// Parsed Allow
+	AllowNets []*net.IPNet `yaml:"-"`
+	// IP addresses and CIDR ranges of the clients refused, even when allowed
+	Deny []string `yaml:"deny"`
+	// Parsed Deny
+	DenyNets []*net.IPNet `yaml:"-"`
+}
+
+// Listener returns the listener with given name, nil when not configured in listeners
+func (zc *Zedis) Listener(name string) *Listener {
+	for i := range zc.Listeners {
+		if zc.Listeners[i].Name == name {
+			return &zc.Listeners[i]
+		}
+	}
+	return nil
+}
+
+// validateListeners checks the listeners and parses their fields
+// at least one listener, port, tls_port or unix_socket needs to be configured
+func validateListeners(zc *Zedis) error {
+	if len(zc.Listeners) == 0 && zc.Port == "" && zc.TLSPort == "" && zc.UnixSocket == "" {
+		return fmt.Errorf("no listeners: set port, tls_port, unix_socket or listeners")
+	}
+
+	// parsed into a copy, the listeners can be shared with a running config
+	listeners := make([]Listener, len(zc.Listeners))
+	copy(listeners, zc.Listeners)
+	names := make(map[string]bool, len(listeners))
+	for i := range listeners {
+		l := &listeners[i]
+		if l.Address == "" {
+			return fmt.Errorf("listener %d has no address", i)
+		}
+		if l.Name == "" {
+			l.Name = l.Address
+		}
+		if reservedListenerNames[l.Name] {
+			return fmt.Errorf("invalid listener name %q: reserved for the listener of port, tls_port or unix_socket", l.Name)
+		}
+		if names[l.Name] {
+			return fmt.Errorf("listener %s is configured more than once", l.Name)
+		}
+		names[l.Name] = true
+
+		err := l.parse()
+		if err != nil {
+			return fmt.Errorf("listener %s: %v", l.Name, err)
+		}
+	}
+	if zc.Listeners != nil {
+		zc.Listeners = listeners
+	}
+	return nil
+}
+
+// parse validates a listener and parses the fields derived from other fields
+func (l *Listener) parse() error {
+	if l.Network == "" {
+		l.Network = "tcp"
+	}
+	switch l.Network {
+	case "tcp", "tcp4", "tcp6":
+		if l.Perm != "" {
+			return fmt.Errorf("perm is only supported by Unix sockets")
+		}
+	case "unix":
+		if l.TLS {
+			return fmt.Errorf("tls is not supported by Unix sockets")
+		}
+	default:
+		return fmt.Errorf("invalid network %q: should be tcp, tcp4, tcp6 or unix", l.Network)
+	}
+
+	if l.Network == "unix" && !l.ProxyProtocol && (len(l.Allow) > 0 || len(l.Deny) > 0) {
+		return fmt.Errorf("allow and deny need the address of the client: only supported by Unix sockets with proxy_protocol")
+	}
+	var err error
+	l.AllowNets, err = parseNets(l.Allow)
+	if err != nil {
+		return fmt.Errorf("invalid allow: %v", err)
+	}
+	l.DenyNets, err = parseNets(l.Deny)
+	if err != nil {
+		return fmt.Errorf("invalid deny: %v", err)
+	}
+
+	perm, err := parsePerm(l.Perm)
+	if err != nil {
+		return fmt.Errorf("invalid perm %q: should be octal permissions, e.g. 770", l.Perm)
+	}
+	l.PermMode = perm
+
+	l.AuthCommands = nil
+	l.AuthAll = false
+	if l.AuthCommandsInput != "" {
+		l.AuthCommands, l.AuthAll = parseAuthCommandList(l.AuthCommandsInput)
+	}
+
+	commands := make([]string, 0, len(l.Commands))
+	for _, name := range l.Commands {
+		commands = append(commands, strings.ToLower(strings.TrimSpace(name)))
+	}
+	if l.Commands != nil {
+		l.Commands = commands
+	}
+	return nil
+}
+
+// parseNets parses a list of IP addresses and CIDR ranges
+// an IP address is a range of only that address
+func parseNets(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address or CIDR range", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", s)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateListeners(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(validateListeners(&Zedis{}), "no listeners")
+	assert.NoError(validateListeners(&Zedis{TLSPort: ":6381"}), "the TLS port is enough")
+	assert.NoError(validateListeners(&Zedis{UnixSocket: "/run/zedis.sock"}), "the unix socket is enough")
+
+	zc := Zedis{
+		Listeners: []Listener{
+			{Address: "10.0.0.1:6379", Commands: []string{" GET", "@Read"}, ReadOnly: true,
+				Allow: []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1"}, Deny: []string{"10.0.0.66"}},
+			{Name: "public", Address: ":6390", TLS: true, AuthCommandsInput: "all"},
+			{Name: "sidecar", Network: "unix", Address: "/run/zedis.sock", Perm: "770", AuthCommandsInput: "none"},
+		},
+	}
+	original := zc.Listeners
+	if assert.NoError(validateListeners(&zc)) {
+		internal := zc.Listener("10.0.0.1:6379")
+		if assert.NotNil(internal, "named after the address") {
+			assert.Equal("tcp", internal.Network)
+			assert.Equal([]string{"get", "@read"}, internal.Commands)
+			assert.Nil(internal.AuthCommands, "auth_commands is used")
+			if assert.Len(internal.AllowNets, 3) {
+				assert.Equal("10.0.0.0/8", internal.AllowNets[0].String())
+				assert.Equal("192.0.2.1/32", internal.AllowNets[1].String())
+				assert.Equal("2001:db8::1/128", internal.AllowNets[2].String())
+			}
+			if assert.Len(internal.DenyNets, 1) {
+				assert.True(internal.DenyNets[0].Contains(net.ParseIP("10.0.0.66")))
+			}
+		}
+		assert.True(zc.Listener("public").AuthAll)
+		sidecar := zc.Listener("sidecar")
+		assert.Equal(os.FileMode(0770), sidecar.PermMode)
+		assert.Empty(sidecar.AuthCommands)
+		assert.NotNil(sidecar.AuthCommands)
+		assert.Nil(zc.Listener("unknown"))
+		assert.Equal("", original[0].Name, "listeners are parsed into a copy")
+		assert.Equal(" GET", original[0].Commands[0])
+	}
+
+	invalid := []Listener{
+		{Name: "no address"},
+		{Name: "plain", Address: ":6379"},
+		{Network: "udp", Address: ":6379"},
+		{Network: "unix", Address: "/run/zedis.sock", TLS: true},
+		{Address: ":6379", Perm: "770"},
+		{Network: "unix", Address: "/run/zedis.sock", Perm: "999"},
+		{Address: ":6379", Allow: []string{"10.0.0.0/33"}},
+		{Address: ":6379", Deny: []string{"localhost"}},
+		{Network: "unix", Address: "/run/zedis.sock", Allow: []string{"10.0.0.1"}},
+	}
+	for _, l := range invalid {
+		assert.Error(validateListeners(&Zedis{Listeners: []Listener{l}}), "%+v", l)
+	}
+	assert.Error(validateListeners(&Zedis{Listeners: []Listener{
+		{Address: ":6379"},
+		{Address: ":6379"},
+	}}), "duplicate names")
+}
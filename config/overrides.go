@@ -0,0 +1,119 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+const (
+	// prefix of the environment variables overriding config fields
+	envPrefix = "ZEDIS_"
+	// suffix of the environment variables and flags reading a config field from a file
+	fileSuffix = "_file"
+)
+
+// Overrides are values of config fields, by YAML name, overriding the values of the config file
+// values are parsed as YAML, strings are taken as is
+type Overrides map[string]string
+
+// EnvOverrides returns the config fields overridden by environment variables:
+// ZEDIS_<FIELD> (e.g.: ZEDIS_IYO_APP_SECRET) sets a field,
+// ZEDIS_<FIELD>_FILE sets a field to the content of a file (e.g.: a mounted secret)
+func EnvOverrides(lookupEnv func(string) (string, bool)) (Overrides, error) {
+	overrides := make(Overrides)
+	for _, name := range FieldNames() {
+		key := envPrefix + strings.ToUpper(name)
+		value, ok := lookupEnv(key)
+		path, fromFile := lookupEnv(key + strings.ToUpper(fileSuffix))
+		if ok && fromFile {
+			return nil, fmt.Errorf("both %s and %s are set", key, key+strings.ToUpper(fileSuffix))
+		}
+		if fromFile {
+			var err error
+			value, err = readOverrideFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", key+strings.ToUpper(fileSuffix), err)
+			}
+		} else if !ok {
+			continue
+		}
+		overrides[name] = value
+	}
+	return overrides, nil
+}
+
+// RegisterFlags registers a flag for every config field on a flag set:
+// -<field> (e.g.: -iyo_app_secret) sets a field,
+// -<field>_file sets a field to the content of a file
+// the returned overrides are filled in when the flags are parsed
+func RegisterFlags(fs *flag.FlagSet) Overrides {
+	overrides := make(Overrides)
+	t := reflect.TypeOf(Zedis{})
+	for i := 0; i < t.NumField(); i++ {
+		name := yamlName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		isBool := t.Field(i).Type.Kind() == reflect.Bool
+		fs.Var(&overrideFlag{overrides: overrides, name: name, isBool: isBool}, name,
+			"overrides the "+name+" config field")
+		fs.Var(&overrideFlag{overrides: overrides, name: name, fromFile: true}, name+fileSuffix,
+			"reads the "+name+" config field from a file")
+	}
+	return overrides
+}
+
+// applyOverrides sets the overridden config fields, later overrides take precedence
+func applyOverrides(zc *Zedis, overrides []Overrides) error {
+	v := reflect.ValueOf(zc).Elem()
+	for _, o := range overrides {
+		for name, value := range o {
+			field, ok := fieldByYAMLName(name)
+			if !ok {
+				return fmt.Errorf("unknown config field '%s'", name)
+			}
+			err := setField(v.FieldByIndex(field.Index), value)
+			if err != nil {
+				return fmt.Errorf("invalid override for '%s': %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readOverrideFile reads a value from a file, without trailing newlines
+func readOverrideFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// overrideFlag is a flag setting an override
+type overrideFlag struct {
+	overrides Overrides
+	name      string
+	// the flag's value is the path of a file holding the value
+	fromFile bool
+	// the flag can be given without value
+	isBool bool
+}
+
+func (f *overrideFlag) String() string   { return "" }
+func (f *overrideFlag) IsBoolFlag() bool { return f.isBool }
+
+func (f *overrideFlag) Set(value string) error {
+	if f.fromFile {
+		var err error
+		value, err = readOverrideFile(value)
+		if err != nil {
+			return err
+		}
+	}
+	f.overrides[f.name] = value
+	return nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis_env")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	secretFile := filepath.Join(dir, "secret")
+	assert.NoError(ioutil.WriteFile(secretFile, []byte("s3cret\n"), 0600))
+
+	env := map[string]string{
+		"ZEDIS_PORT":                ":6390",
+		"ZEDIS_IYO_APP_SECRET_FILE": secretFile,
+		"ZEDIS_COMPRESS":            "true",
+		"OTHER_PORT":                ":1",
+	}
+	lookupEnv := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+
+	overrides, err := EnvOverrides(lookupEnv)
+	assert.NoError(err)
+	assert.Equal(Overrides{"port": ":6390", "iyo_app_secret": "s3cret", "compress": "true"}, overrides)
+
+	env["ZEDIS_IYO_APP_SECRET"] = "other"
+	_, err = EnvOverrides(lookupEnv)
+	assert.Error(err, "both the value and the file are set")
+
+	delete(env, "ZEDIS_IYO_APP_SECRET")
+	env["ZEDIS_ENCRYPT_KEY_FILE"] = filepath.Join(dir, "missing")
+	_, err = EnvOverrides(lookupEnv)
+	assert.Error(err)
+}
+
+func TestRegisterFlags(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis_flags")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	assert.NoError(ioutil.WriteFile(keyFile, []byte("ab345678901234567890123456789012"), 0600))
+
+	fs := flag.NewFlagSet("zedis", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	overrides := RegisterFlags(fs)
+	err = fs.Parse([]string{"-port", ":6390", "-encrypt", "-encrypt_key_file", keyFile, "-data_shards", "[a:1, b:2]"})
+	assert.NoError(err)
+	assert.Equal(Overrides{
+		"port":        ":6390",
+		"encrypt":     "true",
+		"encrypt_key": "ab345678901234567890123456789012",
+		"data_shards": "[a:1, b:2]",
+	}, overrides)
+
+	err = fs.Parse([]string{"-iyo_app_secret_file", filepath.Join(dir, "missing")})
+	assert.Error(err)
+}
+
+func TestNewZedisConfigWithOverrides(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis_overrides")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// the secret is missing from the file, so only valid with the overrides
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(ioutil.WriteFile(path, []byte(`
+port: :6380
+tls_port: :6381
+jwt_organization: zedis_org
+jwt_namespace: zedis_namespace
+organization: zedis_0stor_org
+namespace: zedis_0stor_namespace
+iyo_app_id: app
+data_shards: ["127.0.0.1:12345"]
+meta_shards: ["http://127.0.0.1:2379"]
+`), 0600))
+
+	_, err = NewZedisConfigFromFile(path)
+	assert.Error(err)
+
+	env := Overrides{"iyo_app_secret": "secret", "port": ":6390", "block_size": "1024"}
+	flags := Overrides{"port": ":6400"}
+	zc, err := NewZedisConfigFromFile(path, env, flags)
+	if assert.NoError(err) {
+		assert.Equal("secret", zc.IYOSecret)
+		assert.Equal(":6400", zc.Port, "later overrides take precedence")
+		assert.Equal(1024, zc.BlockSize)
+		assert.Equal([]Overrides{env, flags}, zc.Overrides)
+	}
+
+	_, err = NewZedisConfigFromFile(path, env, Overrides{"block_size": "big"})
+	assert.Error(err)
+	_, err = NewZedisConfigFromFile(path, env, Overrides{"slowlog_max_len": "-1"})
+	assert.Error(err, "negative slowlog length")
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// fields holding secrets, by YAML name
+// they are never returned by FieldValue, also not when nested in another field
+var secretFields = map[string]bool{
+	"iyo_app_secret": true,
+	"encrypt_key":    true,
+}
+
+// FieldValue returns the value of a config field by YAML name
+// scalars are formatted as is, other values as YAML with the nested secrets left out
+// returns false when the field doesn't exist or holds a secret
+func FieldValue(zc *Zedis, name string) (string, bool) {
+	field, ok := fieldByYAMLName(name)
+	if !ok || secretFields[name] {
+		return "", false
+	}
+	value, err := formatValue(reflect.ValueOf(zc).Elem().FieldByIndex(field.Index))
+	if err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+func formatValue(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		if v.IsNil() || (v.Kind() != reflect.Ptr && v.Len() == 0) {
+			return "", nil
+		}
+	}
+
+	data, err := yaml.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	var generic interface{}
+	err = yaml.Unmarshal(data, &generic)
+	if err != nil {
+		return "", err
+	}
+	data, err = yaml.Marshal(withoutSecrets(generic))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// withoutSecrets removes the secret fields from a generic YAML value
+func withoutSecrets(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		for key, v := range value {
+			if name, ok := key.(string); ok && secretFields[name] {
+				delete(value, key)
+				continue
+			}
+			value[key] = withoutSecrets(v)
+		}
+	case []interface{}:
+		for i, v := range value {
+			value[i] = withoutSecrets(v)
+		}
+	}
+	return value
+}
+
+// SetFields returns a copy of a config with the fields set to the values, by YAML name
+// values are parsed as YAML, strings are taken as is
+// the copy is validated the way a config file is
+func SetFields(zc *Zedis, values map[string]string) (*Zedis, error) {
+	next := *zc
+	v := reflect.ValueOf(&next).Elem()
+	for name, value := range values {
+		field, ok := fieldByYAMLName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown config field '%s'", name)
+		}
+
+		err := setField(v.FieldByIndex(field.Index), value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for '%s': %v", name, err)
+		}
+	}
+
+	err := next.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// setField sets a field to a value parsed as YAML, strings are taken as is
+// an empty value sets the zero value of non string fields
+func setField(field reflect.Value, value string) error {
+	parsed := reflect.New(field.Type())
+	if field.Kind() == reflect.String {
+		parsed.Elem().SetString(value)
+	} else if strings.TrimSpace(value) != "" {
+		err := yaml.Unmarshal([]byte(value), parsed.Interface())
+		if err != nil {
+			return err
+		}
+	}
+	field.Set(parsed.Elem())
+	return nil
+}
+
+// RewriteFile writes the values of the config fields with given YAML names to a config file
+// the lines of other fields and comments are kept, fields missing in the file are appended to it
+// the file is written to a temporary file first, so it is never partially written
+func RewriteFile(path string, zc *Zedis, names []string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		lines[len(lines)-1] += "\n"
+	}
+
+	v := reflect.ValueOf(zc).Elem()
+	for _, name := range names {
+		field, ok := fieldByYAMLName(name)
+		if !ok {
+			return fmt.Errorf("unknown config field '%s'", name)
+		}
+		entry, err := yaml.Marshal(yaml.MapSlice{{Key: name, Value: v.FieldByIndex(field.Index).Interface()}})
+		if err != nil {
+			return err
+		}
+		lines = replaceTopLevelEntry(lines, name, string(entry))
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, buf.Bytes(), info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// replaceTopLevelEntry replaces the lines of a top level YAML entry,
+// the key line and the indented or list lines following it
+// the entry is appended when the key isn't found
+func replaceTopLevelEntry(lines []string, key, entry string) []string {
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, key+":") {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return append(lines, entry)
+	}
+
+	end := start + 1
+	for end < len(lines) {
+		line := lines[end]
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "-") {
+			end++
+			continue
+		}
+		break
+	}
+	// comments directly after the entry belong to what follows
+	for end > start+1 && strings.HasPrefix(strings.TrimSpace(lines[end-1]), "#") {
+		end--
+	}
+
+	replaced := make([]string, 0, len(lines))
+	replaced = append(replaced, lines[:start]...)
+	replaced = append(replaced, entry)
+	return append(replaced, lines[end:]...)
+}
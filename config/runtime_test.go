@@ -0,0 +1,141 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldValue(t *testing.T) {
+	assert := assert.New(t)
+	key := "db1key"
+	zc := &Zedis{
+		Port:          ":6380",
+		Compress:      true,
+		BlockSize:     4096,
+		IYOSecret:     "secret",
+		EncryptKey:    "key",
+		ACMEWhitelist: []string{"zedis.org"},
+		Databases: []Database{
+			{Index: 1, Namespace: "ns1", PolicyOverrides: PolicyOverrides{EncryptKey: &key, IYOSecret: "db1secret"}},
+		},
+	}
+
+	for name, expected := range map[string]string{
+		"port":           ":6380",
+		"compress":       "true",
+		"block_size":     "4096",
+		"acme_whitelist": "- zedis.org",
+		"tenants":        "",
+		"jwt_issuers":    "",
+	} {
+		value, ok := FieldValue(zc, name)
+		assert.True(ok, name)
+		assert.Equal(expected, value, name)
+	}
+
+	// secrets are never returned
+	for _, name := range []string{"iyo_app_secret", "encrypt_key", "unknown"} {
+		_, ok := FieldValue(zc, name)
+		assert.False(ok, name)
+	}
+	value, ok := FieldValue(zc, "databases")
+	assert.True(ok)
+	assert.Contains(value, "namespace: ns1")
+	assert.NotContains(value, "db1key")
+	assert.NotContains(value, "db1secret")
+	assert.Equal("key", zc.EncryptKey)
+	assert.Equal("db1key", *zc.Databases[0].EncryptKey, "the config itself is untouched")
+}
+
+func TestSetFields(t *testing.T) {
+	assert := assert.New(t)
+	zc := &Zedis{
+		TLSPort:         ":6381",
+		JWTOrganization: "org",
+		JWTNamespace:    "ns",
+		Organization:    "org",
+		Namespace:       "ns",
+		IYOAppID:        "app",
+		IYOSecret:       "secret",
+		DataShards:      []string{"127.0.0.1:12345"},
+		MetaShards:      []string{"http://127.0.0.1:2379"},
+	}
+	assert.NoError(zc.validate())
+
+	next, err := SetFields(zc, map[string]string{
+		"auth_commands":   "all",
+		"slowlog_max_len": "10",
+		"acme_whitelist":  "[zedis.org, .zedis.com]",
+		"auth_policy":     "{get: .get}",
+	})
+	if assert.NoError(err) {
+		assert.True(next.AuthAll)
+		assert.Equal(10, next.SlowlogMaxLen)
+		assert.Equal([]string{"zedis.org", ".zedis.com"}, next.ACMEWhitelist)
+		assert.Equal(".get", next.AuthPolicy["get"])
+		assert.Equal(".read", next.AuthPolicy["@read"], "default policy is kept")
+		assert.False(zc.AuthAll, "the original config is untouched")
+	}
+
+	_, err = SetFields(zc, map[string]string{"slowlog_max_len": "ten"})
+	assert.Error(err)
+	_, err = SetFields(zc, map[string]string{"slowlog_max_len": "-1"})
+	assert.Error(err, "negative slowlog length")
+	_, err = SetFields(zc, map[string]string{"acme_whitelist": "[zedis*.org]"})
+	assert.Error(err, "validated like a config file")
+	_, err = SetFields(zc, map[string]string{"unknown": "1"})
+	assert.Error(err)
+
+	next, err = SetFields(zc, map[string]string{"acme_whitelist": ""})
+	if assert.NoError(err) {
+		assert.Nil(next.ACMEWhitelist)
+	}
+}
+
+func TestRewriteFile(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis_rewrite")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(ioutil.WriteFile(path, []byte(`# zedis config
+port: :6380   # plain port
+acme_whitelist:
+    - zedis.org # only this one
+# 0-stor
+data_shards:
+    - 127.0.0.1:12345
+slowlog_max_len: 128`), 0640))
+
+	zc := &Zedis{
+		ACMEWhitelist:        []string{"zedis.org", "*.zedis.org"},
+		SlowlogMaxLen:        10,
+		SlowlogLogSlowerThan: -1,
+	}
+	assert.NoError(RewriteFile(path, zc, []string{"acme_whitelist", "slowlog_max_len", "slowlog_log_slower_than"}))
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal(`# zedis config
+port: :6380   # plain port
+acme_whitelist:
+- zedis.org
+- '*.zedis.org'
+# 0-stor
+data_shards:
+    - 127.0.0.1:12345
+slowlog_max_len: 10
+slowlog_log_slower_than: -1
+`, string(data))
+	info, err := os.Stat(path)
+	if assert.NoError(err) {
+		assert.Equal(os.FileMode(0640), info.Mode().Perm())
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/zero-os/0-stor/client"
+)
+
+// NamedStorPolicy is a 0-stor policy of the config, with a name describing where it's used
+type NamedStorPolicy struct {
+	Name   string
+	Policy client.Policy
+}
+
+// StorPolicies returns the 0-stor policies of database 0, the configured databases
+// and, when tenants are enabled, the policy of a tenant without its namespace
+func (zc *Zedis) StorPolicies() []NamedStorPolicy {
+	policies := []NamedStorPolicy{{Name: "database 0", Policy: zc.StorPolicy()}}
+	for _, db := range zc.Databases {
+		policies = append(policies, NamedStorPolicy{
+			Name:   "database " + strconv.Itoa(db.Index),
+			Policy: zc.DatabaseStorPolicy(db),
+		})
+	}
+	if zc.Tenants != nil {
+		policies = append(policies, NamedStorPolicy{Name: "tenants", Policy: zc.TenantStorPolicy("")})
+	}
+	return policies
+}
+
+// ValidateStorPolicy checks a 0-stor policy for mistakes the 0-stor client only reports when reading or writing
+func ValidateStorPolicy(policy client.Policy) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	dataShards := len(policy.DataShards)
+	if dataShards == 0 {
+		fail("no data_shards")
+	}
+	if len(policy.MetaShards) == 0 {
+		fail("no meta_shards")
+	}
+
+	if policy.BlockSize < 0 {
+		fail("block_size %d is negative", policy.BlockSize)
+	}
+	if policy.ReplicationNr < 0 || policy.ReplicationMaxSize < 0 ||
+		policy.DistributionNr < 0 || policy.DistributionRedundancy < 0 {
+		fail("replication_nr, replication_max_size, distribution_data and distribution_parity can't be negative")
+	}
+
+	// replication and distribution can be combined, 0-stor replicates the blocks
+	// of up to replication_max_size bytes and distributes the larger ones
+	if policy.ReplicationNr > dataShards {
+		fail("replication_nr %d needs at least as many data_shards, got %d", policy.ReplicationNr, dataShards)
+	}
+	if policy.ReplicationNr > 0 && policy.ReplicationMaxSize <= 0 {
+		fail("replication_nr is set but replication_max_size is not, no data would be replicated")
+	}
+
+	distribution := policy.DistributionNr + policy.DistributionRedundancy
+	if (policy.DistributionNr > 0) != (policy.DistributionRedundancy > 0) {
+		fail("distribution_data and distribution_parity should be set together")
+	} else if distribution > dataShards {
+		fail("distribution_data + distribution_parity (%d) needs at least as many data_shards, got %d", distribution, dataShards)
+	}
+
+	if policy.Encrypt {
+		switch len(policy.EncryptKey) {
+		case 16, 24, 32:
+		default:
+			fail("encrypt_key should be 16, 24 or 32 bytes for AES encryption, got %d", len(policy.EncryptKey))
+		}
+	}
+	return errs
+}
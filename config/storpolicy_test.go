@@ -0,0 +1,70 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-os/0-stor/client"
+)
+
+func TestValidateStorPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	// blocks of up to 4096 bytes are replicated, larger ones are distributed
+	valid := client.Policy{
+		DataShards:             []string{"a:1", "b:1", "c:1", "d:1"},
+		MetaShards:             []string{"http://e:2379"},
+		ReplicationNr:          4,
+		ReplicationMaxSize:     4096,
+		DistributionNr:         3,
+		DistributionRedundancy: 1,
+		Encrypt:                true,
+		EncryptKey:             "ab345678901234567890123456789012",
+	}
+	assert.Empty(ValidateStorPolicy(valid))
+
+	for name, change := range map[string]func(p *client.Policy){
+		"no shards":                    func(p *client.Policy) { p.DataShards, p.MetaShards = nil, nil },
+		"short encrypt key":            func(p *client.Policy) { p.EncryptKey = "short" },
+		"too much distribution":        func(p *client.Policy) { p.DistributionRedundancy = 2 },
+		"distribution without parity":  func(p *client.Policy) { p.DistributionRedundancy = 0 },
+		"too much replication":         func(p *client.Policy) { p.ReplicationNr = 5 },
+		"replication without max size": func(p *client.Policy) { p.ReplicationMaxSize = 0 },
+		"negative block size":          func(p *client.Policy) { p.BlockSize = -1 },
+	} {
+		policy := valid
+		change(&policy)
+		assert.NotEmpty(ValidateStorPolicy(policy), name)
+	}
+
+	// replication and distribution can be used on their own
+	policy := valid
+	policy.ReplicationNr, policy.ReplicationMaxSize = 0, 0
+	assert.Empty(ValidateStorPolicy(policy))
+	policy = valid
+	policy.DistributionNr, policy.DistributionRedundancy = 0, 0
+	assert.Empty(ValidateStorPolicy(policy))
+
+	// without encryption the key isn't used
+	policy = valid
+	policy.Encrypt, policy.EncryptKey = false, ""
+	assert.Empty(ValidateStorPolicy(policy))
+}
+
+func TestStorPolicies(t *testing.T) {
+	assert := assert.New(t)
+	zc := &Zedis{
+		Namespace: "ns",
+		Databases: []Database{{Index: 1, Namespace: "ns1"}},
+		Tenants:   &Tenants{NamespacePrefix: "tenant_"},
+	}
+
+	policies := zc.StorPolicies()
+	if assert.Len(policies, 3) {
+		assert.Equal("database 0", policies[0].Name)
+		assert.Equal("ns", policies[0].Policy.Namespace)
+		assert.Equal("database 1", policies[1].Name)
+		assert.Equal("ns1", policies[1].Policy.Namespace)
+		assert.Equal("tenants", policies[2].Name)
+	}
+}
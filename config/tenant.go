@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zero-os/0-stor/client"
+)
+
+// tenant names are used in 0-stor namespaces and key prefixes
+var validTenantName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Tenants defines the template of the tenants,
+// a connection is routed to a tenant by the scopes of its JWT:
+// a scope of <jwt_organization>.<tenant> routes it to tenant
+type Tenants struct {
+	// itsyou.online organization of which the namespaces are tenants, required
+	JWTOrganization string `yaml:"jwt_organization"`
+	// prefix of the 0-stor namespace of a tenant, required
+	// the namespace of a tenant is the prefix followed by the tenant name
+	NamespacePrefix string `yaml:"namespace_prefix"`
+
+	// 0-stor policy overrides for all tenants
+	PolicyOverrides `yaml:",inline"`
+}
+
+// ValidTenant returns true if a name can be used as a tenant
+// the JWT namespaces used by database 0 and the databases are not tenants
+func (zc *Zedis) ValidTenant(name string) bool {
+	if zc.Tenants == nil || !validTenantName.MatchString(name) {
+		return false
+	}
+
+	reserved := func(organization, namespace string) bool {
+		return organization == zc.Tenants.JWTOrganization && namespace == name
+	}
+	if reserved(zc.DatabaseJWTScope(0)) {
+		return false
+	}
+	for _, db := range zc.Databases {
+		if reserved(zc.DatabaseJWTScope(db.Index)) {
+			return false
+		}
+	}
+	return true
+}
+
+// TenantStorPolicy returns the 0-stor policy of a tenant
+func (zc *Zedis) TenantStorPolicy(name string) client.Policy {
+	policy := zc.Tenants.apply(zc.StorPolicy())
+	policy.Namespace = zc.Tenants.NamespacePrefix + name
+	return policy
+}
+
+// validateTenants checks if the tenant template is complete
+// and its namespaces can't collide with the ones of the databases
+func validateTenants(zc *Zedis) error {
+	if zc.Tenants == nil {
+		return nil
+	}
+	if zc.Tenants.JWTOrganization == "" {
+		return fmt.Errorf("tenants has no jwt_organization")
+	}
+	if zc.Tenants.NamespacePrefix == "" {
+		return fmt.Errorf("tenants has no namespace_prefix")
+	}
+
+	namespaces := []string{zc.Namespace}
+	for _, db := range zc.Databases {
+		namespaces = append(namespaces, db.Namespace)
+	}
+	for _, namespace := range namespaces {
+		if strings.HasPrefix(namespace, zc.Tenants.NamespacePrefix) {
+			return fmt.Errorf("namespace %s could be used by a tenant: choose a different namespace_prefix", namespace)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantStorPolicy(t *testing.T) {
+	assert := assert.New(t)
+	compress := false
+	zc := Zedis{
+		Organization: "org",
+		Namespace:    "ns",
+		Compress:     true,
+		Tenants: &Tenants{
+			JWTOrganization: "tenants",
+			NamespacePrefix: "tenant_",
+			PolicyOverrides: PolicyOverrides{
+				Compress: &compress,
+			},
+		},
+	}
+
+	policy := zc.TenantStorPolicy("team")
+	assert.Equal("org", policy.Organization)
+	assert.Equal("tenant_team", policy.Namespace)
+	assert.False(policy.Compress)
+}
+
+func TestValidTenant(t *testing.T) {
+	assert := assert.New(t)
+	zc := Zedis{
+		JWTOrganization: "org",
+		JWTNamespace:    "ns",
+		Databases:       []Database{{Index: 1, Namespace: "ns1"}},
+	}
+	assert.False(zc.ValidTenant("team"), "tenants are disabled")
+
+	zc.Tenants = &Tenants{JWTOrganization: "org", NamespacePrefix: "tenant_"}
+	assert.True(zc.ValidTenant("team"))
+	assert.True(zc.ValidTenant("team-1_a"))
+	assert.False(zc.ValidTenant("team:1"))
+	assert.False(zc.ValidTenant(""))
+
+	// namespaces of the databases are not tenants
+	assert.False(zc.ValidTenant("ns"))
+	assert.False(zc.ValidTenant("ns1"))
+}
+
+func TestValidateTenants(t *testing.T) {
+	assert := assert.New(t)
+
+	zc := Zedis{Namespace: "ns"}
+	assert.NoError(validateTenants(&zc), "tenants are optional")
+
+	zc.Tenants = &Tenants{JWTOrganization: "org", NamespacePrefix: "tenant_"}
+	assert.NoError(validateTenants(&zc))
+
+	zc.Tenants = &Tenants{NamespacePrefix: "tenant_"}
+	assert.Error(validateTenants(&zc), "missing jwt organization")
+
+	zc.Tenants = &Tenants{JWTOrganization: "org"}
+	assert.Error(validateTenants(&zc), "missing namespace prefix")
+
+	zc.Tenants = &Tenants{JWTOrganization: "org", NamespacePrefix: "n"}
+	assert.Error(validateTenants(&zc), "main namespace could be a tenant namespace")
+
+	zc.Tenants = &Tenants{JWTOrganization: "org", NamespacePrefix: "tenant_"}
+	zc.Databases = []Database{{Index: 1, Namespace: "tenant_db"}}
+	assert.Error(validateTenants(&zc), "database namespace could be a tenant namespace")
+}
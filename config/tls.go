@@ -0,0 +1,77 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// TLS versions the tls_min_version field can be set to
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLS validates the TLS certificate files and parses the TLS version and cipher suites
+func parseTLS(zc *Zedis) error {
+	if (zc.TLSCertFile == "") != (zc.TLSKeyFile == "") {
+		return fmt.Errorf("tls_cert_file and tls_key_file should be set together")
+	}
+	if zc.TLSChainFile != "" && zc.TLSCertFile == "" {
+		return fmt.Errorf("tls_chain_file requires tls_cert_file and tls_key_file")
+	}
+	if zc.TLSCertFile != "" && zc.ACME {
+		return fmt.Errorf("tls_cert_file can't be used together with acme")
+	}
+	for _, host := range zc.TLSHostnames {
+		if strings.TrimSpace(host) == "" || strings.ContainsAny(host, "/ ") {
+			return fmt.Errorf("invalid tls_hostnames entry %q", host)
+		}
+	}
+	for _, pattern := range zc.ACMEWhitelist {
+		if !validHostPattern(pattern) {
+			return fmt.Errorf("invalid acme_whitelist entry %q: should be a hostname, *.domain or .domain", pattern)
+		}
+	}
+
+	zc.TLSMinVersionID = tls.VersionTLS12
+	if zc.TLSMinVersion != "" {
+		version, ok := tlsVersions[strings.TrimSpace(zc.TLSMinVersion)]
+		if !ok {
+			return fmt.Errorf("invalid tls_min_version %q: should be 1.2 or 1.3", zc.TLSMinVersion)
+		}
+		zc.TLSMinVersionID = version
+	}
+
+	zc.TLSCipherSuiteIDs = nil
+	for _, name := range zc.TLSCipherSuites {
+		id, ok := cipherSuiteID(strings.TrimSpace(name))
+		if !ok {
+			return fmt.Errorf("unknown or insecure cipher suite %q in tls_cipher_suites", name)
+		}
+		zc.TLSCipherSuiteIDs = append(zc.TLSCipherSuiteIDs, id)
+	}
+	return nil
+}
+
+// cipherSuiteID returns the ID of a secure cipher suite by its name (e.g.: TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256)
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// validHostPattern checks an ACME whitelist entry:
+// an exact hostname, *.domain matching a single subdomain level or .domain matching any subdomain
+func validHostPattern(pattern string) bool {
+	host := strings.TrimPrefix(pattern, "*")
+	if strings.HasPrefix(pattern, "*") && !strings.HasPrefix(host, ".") {
+		return false
+	}
+	host = strings.TrimPrefix(host, ".")
+	return host != "" && !strings.ContainsAny(host, "*/: ") &&
+		!strings.HasPrefix(host, ".") && !strings.HasSuffix(host, ".") && !strings.Contains(host, "..")
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	// defaults
+	zc := Zedis{}
+	assert.NoError(parseTLS(&zc))
+	assert.Equal(uint16(tls.VersionTLS12), zc.TLSMinVersionID)
+	assert.Nil(zc.TLSCipherSuiteIDs)
+
+	zc = Zedis{
+		TLSCertFile:     "cert.pem",
+		TLSKeyFile:      "key.pem",
+		TLSChainFile:    "chain.pem",
+		TLSMinVersion:   "1.3",
+		TLSCipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+	}
+	assert.NoError(parseTLS(&zc))
+	assert.Equal(uint16(tls.VersionTLS13), zc.TLSMinVersionID)
+	assert.Equal([]uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}, zc.TLSCipherSuiteIDs)
+
+	// invalid configs
+	assert.Error(parseTLS(&Zedis{TLSCertFile: "cert.pem"}), "missing key file")
+	assert.Error(parseTLS(&Zedis{TLSChainFile: "chain.pem"}), "chain without certificate")
+	assert.Error(parseTLS(&Zedis{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", ACME: true}), "files and ACME")
+	assert.Error(parseTLS(&Zedis{TLSHostnames: []string{"zedis.org", ""}}), "empty hostname")
+	assert.Error(parseTLS(&Zedis{TLSMinVersion: "1.1"}), "TLS 1.1 is no longer allowed")
+	assert.Error(parseTLS(&Zedis{TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}), "insecure cipher suite")
+}
+
+func TestValidHostPattern(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, pattern := range []string{"zedis.org", "*.zedis.org", ".zedis.org", "localhost"} {
+		assert.True(validHostPattern(pattern), pattern)
+	}
+	for _, pattern := range []string{"", "*", "*zedis.org", "zedis.*.org", "..zedis.org", "zedis.org.", "zedis.org:443", ".", "*."} {
+		assert.False(validHostPattern(pattern), pattern)
+	}
+	assert.Error(parseTLS(&Zedis{ACMEWhitelist: []string{"zedis.org", "*zedis.org"}}))
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// parseUnixSocket parses the permissions and auth commands of the Unix socket
+func parseUnixSocket(zc *Zedis) error {
+	perm, err := parsePerm(zc.UnixSocketPerm)
+	if err != nil {
+		return fmt.Errorf("invalid unix_socket_perm %q: should be octal permissions, e.g. 770", zc.UnixSocketPerm)
+	}
+	zc.UnixSocketPermMode = perm
+
+	zc.UnixSocketAuthCommands = nil
+	zc.UnixSocketAuthAll = false
+	if zc.UnixSocketAuthCommandsInput != "" {
+		zc.UnixSocketAuthCommands, zc.UnixSocketAuthAll = parseAuthCommandList(zc.UnixSocketAuthCommandsInput)
+	}
+	return nil
+}
+
+// parsePerm parses octal Unix socket permissions, 0 when empty
+func parsePerm(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	perm, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if perm > 0777 {
+		return 0, fmt.Errorf("%o is not a permission", perm)
+	}
+	return os.FileMode(perm), nil
+}
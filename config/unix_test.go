@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUnixSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	zc := Zedis{UnixSocket: "/run/zedis.sock"}
+	assert.NoError(parseUnixSocket(&zc))
+	assert.Equal(os.FileMode(0), zc.UnixSocketPermMode)
+	assert.Nil(zc.UnixSocketAuthCommands, "auth_commands is used when not set")
+
+	zc.UnixSocketPerm = "770"
+	zc.UnixSocketAuthCommandsInput = "none"
+	assert.NoError(parseUnixSocket(&zc))
+	assert.Equal(os.FileMode(0770), zc.UnixSocketPermMode)
+	assert.Empty(zc.UnixSocketAuthCommands)
+	assert.NotNil(zc.UnixSocketAuthCommands, "trusted local channel")
+	assert.False(zc.UnixSocketAuthAll)
+
+	zc.UnixSocketAuthCommandsInput = "all"
+	assert.NoError(parseUnixSocket(&zc))
+	assert.True(zc.UnixSocketAuthAll)
+
+	zc.UnixSocketPerm = "rwx"
+	assert.Error(parseUnixSocket(&zc), "not octal")
+	zc.UnixSocketPerm = "1777"
+	assert.Error(parseUnixSocket(&zc), "not a permission")
+}
@@ -2,7 +2,9 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
 	"strings"
 
 	valid "github.com/asaskevich/govalidator"
@@ -14,11 +16,31 @@ import (
 var allAUTHCommands = []string{
 	"GET",
 	"SET",
+	"EXISTS",
+	"SLOWLOG",
+	"INFO",
+}
+
+// scope suffixes required for the command categories when not configured
+var defaultAuthPolicy = map[string]string{
+	"@read":  ".read",
+	"@write": ".write",
+	"@admin": ".admin",
 }
 
 // NewZedisConfigFromFile returns a full zedis config from a given YAML file
-func NewZedisConfigFromFile(filePath string) (*Zedis, error) {
-	zc := new(Zedis)
+// the overrides are applied to the fields of the file before the config is validated,
+// later overrides take precedence
+func NewZedisConfigFromFile(filePath string, overrides ...Overrides) (*Zedis, error) {
+	// defaults for optional fields
+	zc := &Zedis{
+		SlowlogLogSlowerThan: 10000,
+		SlowlogMaxLen:        128,
+		MaxClients:           defaultMaxClients,
+		TCPKeepAlive:         defaultTCPKeepAlive,
+		CommandTimeout:       defaultCommandTimeout,
+		ProtectedMode:        true,
+	}
 
 	bs, err := ioutil.ReadFile(filePath)
 	if err != nil {
@@ -29,38 +51,193 @@ func NewZedisConfigFromFile(filePath string) (*Zedis, error) {
 	if err != nil {
 		return nil, err
 	}
-	_, err = valid.ValidateStruct(zc)
+	zc.Path = filePath
+	err = applyOverrides(zc, overrides)
+	if err != nil {
+		return nil, err
+	}
+	zc.Overrides = overrides
+
+	err = zc.validate()
 	if err != nil {
 		return nil, err
 	}
+	return zc, nil
+}
+
+// validate validates the config and parses the fields derived from other fields
+func (zc *Zedis) validate() error {
+	_, err := valid.ValidateStruct(zc)
+	if err != nil {
+		return err
+	}
+	if zc.SlowlogMaxLen < 0 {
+		return fmt.Errorf("invalid slowlog_max_len %d: can't be negative", zc.SlowlogMaxLen)
+	}
 
 	// parse authenticated commands
 	parseAuthCommands(zc)
-
-	return zc, nil
+	err = parseAuthPolicy(zc)
+	if err != nil {
+		return err
+	}
+	err = validateDatabases(zc)
+	if err != nil {
+		return err
+	}
+	err = validateTenants(zc)
+	if err != nil {
+		return err
+	}
+	err = validateJWTIssuers(zc)
+	if err != nil {
+		return err
+	}
+	err = validateLimits(zc)
+	if err != nil {
+		return err
+	}
+	err = validateTimeouts(zc)
+	if err != nil {
+		return err
+	}
+	err = parseUnixSocket(zc)
+	if err != nil {
+		return err
+	}
+	err = validateListeners(zc)
+	if err != nil {
+		return err
+	}
+	err = validateTLSClientAuth(zc)
+	if err != nil {
+		return err
+	}
+	return parseTLS(zc)
 }
 
 // Zedis represents a full zedis config
 type Zedis struct {
+	// Path of the file the config was loaded from
+	Path string `yaml:"-"`
+	// Overrides applied to the fields of the config file
+	Overrides []Overrides `yaml:"-"`
+
 	// Port of the Redis interface
 	Port string `yaml:"port"`
 	//TLS protected port of the Redis interface
-	TLSPort string `yaml:"tls_port" valid:"required"`
+	TLSPort string `yaml:"tls_port"`
+	// Path of the Unix socket of the Redis interface, disabled when empty
+	UnixSocket string `yaml:"unix_socket"`
+	// Octal permissions of the Unix socket (e.g. 770), the umask decides when empty
+	UnixSocketPerm string `yaml:"unix_socket_perm"`
+	// Parsed UnixSocketPerm
+	UnixSocketPermMode os.FileMode `yaml:"-"`
+	// Commands that require authentication on the Unix socket, in the format of auth_commands
+	// the Unix socket uses auth_commands when empty, none makes it a trusted local channel
+	UnixSocketAuthCommandsInput string `yaml:"unix_socket_auth_commands"`
+	// Parsed UnixSocketAuthCommandsInput, nil when empty
+	UnixSocketAuthCommands map[string]struct{} `yaml:"-"`
+	// Set when all commands require authentication on the Unix socket
+	UnixSocketAuthAll bool `yaml:"-"`
+	// Additional interfaces Redis is served on, each with their own policy
+	Listeners []Listener `yaml:"listeners"`
+	// Only accept clients from the loopback interface on plaintext listeners
+	// on which no commands require authentication, unless the listener has an allow list
+	ProtectedMode bool `yaml:"protected_mode"`
+	// Address of the HTTP listener serving Prometheus metrics
+	// metrics are disabled when empty
+	MetricsAddr string `yaml:"metrics_addr"`
 
 	// Defines the commands that require authentication
 	AuthCommandsInput string `yaml:"auth_commands"`
 	// Parsed AuthCommandsInput into a map of commands that require authentication
 	AuthCommands map[string]struct{} `yaml:"-"`
+	// Set when all commands require authentication
+	AuthAll bool `yaml:"-"`
+	// Maps commands (e.g. del) or command categories (e.g. @read) to the scope suffix
+	// (e.g. .read) a JWT requires to execute them
+	// an empty suffix only allows the admin scope of the namespace
+	AuthPolicy map[string]string `yaml:"auth_policy"`
+
+	// Path of the file the local ACL users are loaded from and saved to
+	// ACL LOAD and ACL SAVE are disabled when empty
+	ACLFile string `yaml:"acl_file"`
+
+	// Commands taking longer than this amount of microseconds are logged in the slowlog
+	// 0 logs every command, a negative value disables the slowlog
+	SlowlogLogSlowerThan int64 `yaml:"slowlog_log_slower_than"`
+	// Maximum amount of entries kept in the slowlog
+	SlowlogMaxLen int `yaml:"slowlog_max_len"`
+
+	// Maximum amount of connected clients, 0 allows any amount
+	MaxClients int `yaml:"maxclients"`
+	// Maximum amount of connected clients per IP address, 0 allows any amount
+	MaxClientsPerIP int `yaml:"maxclients_per_ip"`
+	// Rate limits of command categories (e.g. @write), by category
+	// each authenticated subject, or IP address of unauthenticated connections, has its own limits
+	RateLimits map[string]RateLimit `yaml:"rate_limits"`
+
+	// Seconds after which a connection that didn't send a command is closed, 0 never closes idle connections
+	Timeout int `yaml:"timeout"`
+	// Seconds between TCP keepalive probes of the connections, 0 disables keepalive
+	TCPKeepAlive int `yaml:"tcp_keepalive"`
+	// Milliseconds a command may wait for the 0-stor, 0 waits as long as the 0-stor takes
+	CommandTimeout int `yaml:"command_timeout"`
 
 	// JWT authentication
 	JWTOrganization string `yaml:"jwt_organization" valid:"required"`
 	JWTNamespace    string `yaml:"jwt_namespace" valid:"required"`
+	// Issuers trusted to sign JWTs
+	// itsyou.online is the only trusted issuer when empty
+	JWTIssuers []JWTIssuer `yaml:"jwt_issuers"`
+	// Path of the file the JWT revocation list is persisted to
+	// revocations are only kept in memory when empty
+	RevocationFile string `yaml:"revocation_file"`
+
+	// PEM encoded certificate and private key served by the TLS port
+	// reloaded when the files change, ACME or self signed certificates are used when empty
+	TLSCertFile string `yaml:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file"`
+	// PEM encoded intermediate certificates served after the certificate, optional
+	TLSChainFile string `yaml:"tls_chain_file"`
+	// Minimum TLS version of TLS connections, 1.2 (default) or 1.3
+	TLSMinVersion string `yaml:"tls_min_version"`
+	// Parsed TLSMinVersion
+	TLSMinVersionID uint16 `yaml:"-"`
+	// Cipher suites allowed for TLS 1.2 connections, Go's defaults when empty
+	TLSCipherSuites []string `yaml:"tls_cipher_suites"`
+	// Parsed TLSCipherSuites
+	TLSCipherSuiteIDs []uint16 `yaml:"-"`
+
+	// Directory the self signed CA is persisted in
+	// a new CA is generated on every start when empty
+	TLSCADir string `yaml:"tls_ca_dir"`
+	// Hostnames and IP addresses of the self signed certificates, localhost when empty
+	TLSHostnames []string `yaml:"tls_hostnames"`
+
+	// Client certificate authentication of TLS connections
+	// disabled when not set
+	TLSClientAuth *TLSClientAuth `yaml:"tls_client_auth"`
 
 	// ACME (let's encrypt) TLS proxy
 	// defines if caddy should be used
 	ACME bool `yaml:"acme"`
 	// path of caddy config file
 	ACMEWhitelist []string `yaml:"acme_whitelist"`
+	// Directory certificates and the account key are cached in, so they survive restarts
+	// certificates are only kept in memory when empty
+	ACMECacheDir string `yaml:"acme_cache_dir"`
+	// Directory URL of the ACME server, let's encrypt when empty
+	ACMEDirectoryURL string `yaml:"acme_directory_url"`
+	// PEM encoded CA bundle verifying the HTTPS connection to the ACME server
+	// the system CAs are used when empty
+	ACMEDirectoryCAFile string `yaml:"acme_directory_ca_file"`
+	// Contact email address of the ACME account, optional
+	ACMEEmail string `yaml:"acme_email"`
+	// Address of the HTTP listener answering ACME HTTP-01 challenges, e.g. :80
+	// only TLS-ALPN challenges on the TLS port are answered when empty
+	ACMEHTTPAddr string `yaml:"acme_http_addr"`
 
 	// 0-stor specific
 
@@ -102,6 +279,16 @@ type Zedis struct {
 	Encrypt bool `yaml:"encrypt"`
 	// Key used during encryption
 	EncryptKey string `yaml:"encrypt_key"`
+
+	// Numbered databases that can be selected with SELECT,
+	// each stored in their own 0-stor namespace
+	// database 0 is the namespace configured above
+	Databases []Database `yaml:"databases"`
+
+	// Template of the tenants, each stored in their own 0-stor namespace
+	// connections are routed to a tenant by the scopes of their JWT
+	// tenants are disabled when not set
+	Tenants *Tenants `yaml:"tenants"`
 }
 
 // StorPolicy returns 0-Stor policy from Zedis config
@@ -127,31 +314,58 @@ func (zc *Zedis) StorPolicy() client.Policy {
 }
 
 func parseAuthCommands(zc *Zedis) {
-	zc.AuthCommands = make(map[string]struct{})
+	zc.AuthCommands, zc.AuthAll = parseAuthCommandList(zc.AuthCommandsInput)
+}
+
+// parseAuthCommandList parses a comma separated list of commands that require authentication
+// returns true as well when all commands require authentication
+func parseAuthCommandList(input string) (map[string]struct{}, bool) {
+	authCommands := make(map[string]struct{})
 	// default
-	if zc.AuthCommandsInput == "" {
-		zc.AuthCommands["SET"] = struct{}{}
-		return
+	if input == "" {
+		authCommands["SET"] = struct{}{}
+		return authCommands, false
 	}
 
-	authList := strings.Split(zc.AuthCommandsInput, ",")
+	authList := strings.Split(input, ",")
 
 	// if no authentication required
 	if strings.ToLower(authList[0]) == "none" {
-		return
+		return authCommands, false
 	}
 
 	// if all supported commands need authentication
 	if strings.ToLower(authList[0]) == "all" {
 		for _, a := range allAUTHCommands {
-			zc.AuthCommands[a] = struct{}{}
+			authCommands[a] = struct{}{}
 		}
-		return
+		return authCommands, true
 	}
 
 	for _, a := range authList {
 		a = strings.TrimSpace(a)
 		a = strings.ToUpper(a)
-		zc.AuthCommands[a] = struct{}{}
+		authCommands[a] = struct{}{}
 	}
+	return authCommands, false
+}
+
+// parseAuthPolicy normalizes the auth policy and adds the default category policies
+func parseAuthPolicy(zc *Zedis) error {
+	policy := make(map[string]string, len(defaultAuthPolicy)+len(zc.AuthPolicy))
+	for name, suffix := range defaultAuthPolicy {
+		policy[name] = suffix
+	}
+
+	for name, suffix := range zc.AuthPolicy {
+		name = strings.ToLower(strings.TrimSpace(name))
+		suffix = strings.TrimSpace(suffix)
+		if suffix != "" && (!strings.HasPrefix(suffix, ".") || len(suffix) == 1) {
+			return fmt.Errorf("invalid scope suffix %q for %s in auth_policy: should start with a '.'", suffix, name)
+		}
+		policy[name] = suffix
+	}
+
+	zc.AuthPolicy = policy
+	return nil
 }
@@ -35,8 +35,44 @@ func TestAuthParse(t *testing.T) {
 	}
 	parseAuthCommands(&zc)
 
+	assert.True(zc.AuthAll)
 	for _, c := range allAUTHCommands {
 		_, ok := zc.AuthCommands[c]
 		assert.True(ok)
 	}
 }
+
+func TestAuthPolicyParse(t *testing.T) {
+	assert := assert.New(t)
+
+	// defaults
+	zc := Zedis{}
+	err := parseAuthPolicy(&zc)
+	assert.NoError(err)
+	assert.Equal(defaultAuthPolicy, zc.AuthPolicy)
+
+	// configured entries are normalized and override the defaults
+	zc = Zedis{
+		AuthPolicy: map[string]string{
+			" DEL ":      ".delete",
+			"@read":      ".reader",
+			"@dangerous": "",
+		},
+	}
+	err = parseAuthPolicy(&zc)
+	assert.NoError(err)
+	assert.Equal(".delete", zc.AuthPolicy["del"])
+	assert.Equal(".reader", zc.AuthPolicy["@read"])
+	assert.Equal(".write", zc.AuthPolicy["@write"])
+	suffix, ok := zc.AuthPolicy["@dangerous"]
+	assert.True(ok)
+	assert.Empty(suffix)
+
+	// invalid suffixes
+	for _, suffix := range []string{"read", "."} {
+		zc = Zedis{
+			AuthPolicy: map[string]string{"get": suffix},
+		}
+		assert.Error(parseAuthPolicy(&zc), "suffix %q should be invalid", suffix)
+	}
+}
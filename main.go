@@ -2,30 +2,59 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"runtime"
+	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/zero-os/zedis/config"
 	"github.com/zero-os/zedis/server"
+	"github.com/zero-os/zedis/stor"
 )
 
-var (
-	verbose *bool
-	cfgFile *string
-)
+// version of zedis, set at build time with -ldflags "-X main.version=<version>"
+var version = "dev"
+
+const usage = `Usage: zedis [command] [flags]
+
+Commands:
+  serve         serves Redis with the config (default)
+  check-config  validates the config and its 0-stor policies, without serving
+  version       prints the version
+
+Run zedis <command> -h for the flags of a command.
+`
 
 func main() {
 	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
 	log.SetOutput(os.Stdout)
 
-	parseFlags()
+	// serve is the default command, so flags can be given without command
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
-	if *verbose {
-		log.SetLevel(log.DebugLevel)
-		log.Debug("Zedis is set to verbose")
+	switch command {
+	case "serve":
+		serve(args)
+	case "check-config":
+		checkConfig(args)
+	case "version":
+		fmt.Printf("zedis %s (%s %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
 	}
+}
+
+func serve(args []string) {
+	fs, cf := newFlagSet("serve")
+	fs.Parse(args)
 
-	cfg, err := config.NewZedisConfigFromFile(*cfgFile)
+	cfg, err := cf.load()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -36,8 +65,77 @@ func main() {
 	}
 }
 
-func parseFlags() {
-	verbose = flag.Bool("v", false, "Set verbose output")
-	cfgFile = flag.String("cfg", "./config.yaml", "Path of config file")
-	flag.Parse()
+// checkConfig validates the config and the 0-stor policies,
+// optionally dialing the shards, and exits with status 1 when something is wrong
+func checkConfig(args []string) {
+	fs, cf := newFlagSet("check-config")
+	dial := fs.Bool("dial", false, "Check if the data and meta shards are reachable")
+	timeout := fs.Duration("timeout", 5*time.Second, "Timeout of dialing a shard")
+	fs.Parse(args)
+
+	cfg, err := cf.load()
+	if err != nil {
+		fmt.Printf("%s: invalid config: %v\n", *cf.cfgFile, err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, p := range cfg.StorPolicies() {
+		errs := config.ValidateStorPolicy(p.Policy)
+		for _, err := range errs {
+			fmt.Printf("%s: 0-stor policy: %v\n", p.Name, err)
+		}
+		failed = failed || len(errs) > 0
+
+		if !*dial {
+			continue
+		}
+		for _, status := range stor.DialShards(p.Policy, *timeout) {
+			if status.Err != nil {
+				fmt.Printf("%s: %s shard %s unreachable: %v\n", p.Name, status.Kind, status.Address, status.Err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s: %s shard %s reachable\n", p.Name, status.Kind, status.Address)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Printf("%s: config OK\n", *cf.cfgFile)
+}
+
+// configFlags are the flags loading the config
+type configFlags struct {
+	verbose *bool
+	cfgFile *string
+	// config fields overridden by flags
+	overrides config.Overrides
+}
+
+// newFlagSet returns the flag set of a command, with the flags loading the config
+func newFlagSet(command string) (*flag.FlagSet, *configFlags) {
+	fs := flag.NewFlagSet("zedis "+command, flag.ExitOnError)
+	cf := &configFlags{
+		verbose:   fs.Bool("v", false, "Set verbose output"),
+		cfgFile:   fs.String("cfg", "./config.yaml", "Path of config file"),
+		overrides: config.RegisterFlags(fs),
+	}
+	return fs, cf
+}
+
+// load loads the config file with the environment variable and flag overrides
+func (cf *configFlags) load() (*config.Zedis, error) {
+	if *cf.verbose {
+		log.SetLevel(log.DebugLevel)
+		log.Debug("Zedis is set to verbose")
+	}
+
+	// flags take precedence over environment variables
+	envOverrides, err := config.EnvOverrides(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	return config.NewZedisConfigFromFile(*cf.cfgFile, envOverrides, cf.overrides)
 }
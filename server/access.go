@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"net"
+
+	"github.com/zero-os/zedis/config"
+)
+
+var (
+	errDeniedAddr    = errors.New("connections from your address are not allowed on this listener")
+	errProtectedMode = errors.New("Zedis is running in protected mode because no commands require authentication on this plaintext listener. " +
+		"In this mode connections are only accepted from the loopback interface. " +
+		"To accept other clients, set auth_commands, serve them over TLS, restrict the listener with an allow list or set protected_mode to false.")
+)
+
+// checkAccess checks if a client may connect to a listener,
+// by the allow and deny lists of the listener and protected mode
+// Unix socket connections without a proxied address are always allowed
+func checkAccess(listener string, host string) error {
+	if host == "" {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	zc := zConfig()
+	l := zc.Listener(listener)
+
+	if l != nil {
+		if containsIP(l.DenyNets, ip) || (len(l.AllowNets) > 0 && !containsIP(l.AllowNets, ip)) {
+			rejectedConns.add("denied", 1)
+			return errDeniedAddr
+		}
+	}
+
+	if zc.ProtectedMode && plaintextListener(listener, l) && (l == nil || len(l.AllowNets) == 0) && !ip.IsLoopback() {
+		auth, all := listenerAuthCommands(listener)
+		if len(auth) == 0 && !all {
+			rejectedConns.add("protected_mode", 1)
+			return errProtectedMode
+		}
+	}
+	return nil
+}
+
+// plaintextListener returns true when a listener doesn't serve TLS
+func plaintextListener(listener string, l *config.Listener) bool {
+	if l != nil {
+		return !l.TLS
+	}
+	return listener != "tls"
+}
+
+// containsIP returns true when one of the networks contains the IP address
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
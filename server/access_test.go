@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-os/zedis/config"
+)
+
+func TestCheckAccess(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.ProtectedMode = false
+	cfg.Listeners = []config.Listener{
+		{
+			Name:      "internal",
+			AllowNets: []*net.IPNet{cidr("10.0.0.0/8"), cidr("2001:db8::/32")},
+			DenyNets:  []*net.IPNet{cidr("10.0.0.66/32")},
+		},
+		{Name: "public", DenyNets: []*net.IPNet{cidr("203.0.113.0/24")}},
+	}
+	setZConfig(&cfg)
+
+	assert.NoError(checkAccess("internal", "10.1.2.3"))
+	assert.NoError(checkAccess("internal", "2001:db8::1"))
+	assert.Equal(errDeniedAddr, checkAccess("internal", "10.0.0.66"), "denied even when allowed")
+	assert.Equal(errDeniedAddr, checkAccess("internal", "192.0.2.1"), "not allowed")
+	assert.NoError(checkAccess("internal", ""), "Unix socket connection")
+	assert.NoError(checkAccess("public", "192.0.2.1"))
+	assert.Equal(errDeniedAddr, checkAccess("public", "203.0.113.5"))
+	assert.NoError(checkAccess("plain", "203.0.113.5"), "listeners of port and tls_port have no lists")
+}
+
+func TestProtectedMode(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.ProtectedMode = true
+	cfg.AuthCommands = map[string]struct{}{}
+	cfg.AuthAll = false
+	cfg.Listeners = []config.Listener{
+		{Name: "internal", AllowNets: []*net.IPNet{cidr("10.0.0.0/8")}},
+		{Name: "public", TLS: true},
+		{Name: "lb"},
+		{Name: "guarded", AuthCommands: map[string]struct{}{"SET": {}}},
+	}
+	setZConfig(&cfg)
+
+	assert.Equal(errProtectedMode, checkAccess("plain", "192.0.2.1"))
+	assert.Equal(errProtectedMode, checkAccess("lb", "192.0.2.1"))
+	assert.NoError(checkAccess("plain", "127.0.0.1"), "loopback clients")
+	assert.NoError(checkAccess("plain", "::1"), "loopback clients")
+	assert.NoError(checkAccess("tls", "192.0.2.1"), "TLS listeners")
+	assert.NoError(checkAccess("public", "192.0.2.1"), "TLS listeners")
+	assert.NoError(checkAccess("internal", "10.0.0.1"), "listeners with an allow list")
+	assert.NoError(checkAccess("guarded", "192.0.2.1"), "commands require authentication")
+
+	conn := &addrConn{addr: "192.0.2.1:1000"}
+	assert.False(accept("plain")(conn))
+	assert.True(strings.HasPrefix(conn.s, "DENIED Zedis is running in protected mode"))
+	clientsLock.Lock()
+	_, ok := clients[conn]
+	clientsLock.Unlock()
+	assert.False(ok, "the state of a rejected connection is dropped")
+
+	cfg.ProtectedMode = false
+	assert.NoError(checkAccess("plain", "192.0.2.1"))
+}
+
+func TestDeniedTLSConnection(t *testing.T) {
+	assert := assert.New(t)
+	ca, err := genCA()
+	if !assert.NoError(err) {
+		return
+	}
+	cert, err := ca.issue([]string{"127.0.0.1"})
+	if !assert.NoError(err) {
+		return
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.Listeners = []config.Listener{{
+		Name: "secure", Network: "tcp", Address: addr, TLS: true,
+		DenyNets: []*net.IPNet{cidr("127.0.0.2/32")},
+	}}
+	setZConfig(&cfg)
+	go listenAndServe(cfg.Listeners[0], &tls.Config{Certificates: []tls.Certificate{*cert}})
+
+	// a denied client that never starts the handshake
+	dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP("127.0.0.2")}}
+	var denied net.Conn
+	for i := 0; i < 100; i++ {
+		denied, err = dialer.Dial("tcp", addr)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !assert.NoError(err) {
+		return
+	}
+	defer denied.Close()
+
+	// doesn't hold up accepting other clients
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	deadline := time.Now().Add(rejectTimeout / 2)
+	conn, err := tls.DialWithDialer(&net.Dialer{Deadline: deadline}, "tcp", addr, &tls.Config{RootCAs: roots})
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+	_, err = conn.Write([]byte("PING\r\n"))
+	assert.NoError(err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("+PONG\r\n", line)
+
+	// and is closed without writing anything
+	denied.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := denied.Read(make([]byte, 1))
+	assert.Equal(0, n)
+	assert.Equal(io.EOF, err)
+
+	// other tests list the clients
+	conn.Close()
+	for i := 0; i < 100 && listed("secure"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// listed returns true when CLIENT LIST has a connection of the listener
+func listed(listener string) bool {
+	for _, info := range listClients() {
+		if info.listener == listener {
+			return true
+		}
+	}
+	return false
+}
+
+func cidr(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
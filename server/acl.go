@@ -0,0 +1,488 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+)
+
+var (
+	// local ACL users, by name
+	aclUsers     = make(map[string]*aclUser)
+	aclUsersLock = new(sync.RWMutex)
+)
+
+// aclUser is a local user authenticating with AUTH username password
+type aclUser struct {
+	name    string
+	enabled bool
+	// user can authenticate with any password
+	nopass bool
+	// hex encoded SHA-256 hashes of the passwords
+	passwords []string
+	// glob-style patterns of the keys the user can access
+	keyPatterns []string
+	// command rules (e.g.: +@read, -exists), applied in order
+	commandRules []string
+}
+
+// newACLUser returns a disabled user without any permissions
+func newACLUser(name string) *aclUser {
+	return &aclUser{
+		name:         name,
+		commandRules: []string{"-@all"},
+	}
+}
+
+// copy returns a deep copy of the user, so rules can be applied without touching the original
+func (u *aclUser) copy() *aclUser {
+	cp := *u
+	cp.passwords = append([]string(nil), u.passwords...)
+	cp.keyPatterns = append([]string(nil), u.keyPatterns...)
+	cp.commandRules = append([]string(nil), u.commandRules...)
+	return &cp
+}
+
+// apply applies ACL SETUSER rules to the user
+func (u *aclUser) apply(rules []string) error {
+	for _, rule := range rules {
+		err := u.applyRule(rule)
+		if err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %s", rule, err)
+		}
+	}
+	return nil
+}
+
+func (u *aclUser) applyRule(rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		u.enabled = true
+		return nil
+	case "off":
+		u.enabled = false
+		return nil
+	case "nopass":
+		u.nopass = true
+		u.passwords = nil
+		return nil
+	case "resetpass":
+		u.nopass = false
+		u.passwords = nil
+		return nil
+	case "allkeys":
+		u.keyPatterns = []string{"*"}
+		return nil
+	case "resetkeys":
+		u.keyPatterns = nil
+		return nil
+	case "allcommands":
+		return u.applyRule("+@all")
+	case "nocommands":
+		return u.applyRule("-@all")
+	case "reset":
+		*u = *newACLUser(u.name)
+		return nil
+	}
+
+	if rule == "" {
+		return fmt.Errorf("Syntax error")
+	}
+	switch rule[0] {
+	case '>':
+		u.addPassword(hashPassword(rule[1:]))
+	case '<':
+		u.removePassword(hashPassword(rule[1:]))
+	case '#':
+		hash := strings.ToLower(rule[1:])
+		if !validPasswordHash(hash) {
+			return fmt.Errorf("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.addPassword(hash)
+	case '!':
+		u.removePassword(strings.ToLower(rule[1:]))
+	case '~':
+		u.keyPatterns = append(u.keyPatterns, rule[1:])
+	case '+', '-':
+		name := strings.ToLower(rule[1:])
+		// e.g.: +select|1 allows selecting database 1
+		command := name
+		if i := strings.Index(name, "|"); i >= 0 {
+			if rule[0] == '-' || i == len(name)-1 {
+				return fmt.Errorf("Only a first argument can be allowed")
+			}
+			command = name[:i]
+		}
+		if strings.HasPrefix(name, "@") {
+			if command != name || !validCategory(name) {
+				return fmt.Errorf("Unknown command category")
+			}
+		} else if _, ok := commands[command]; !ok {
+			return fmt.Errorf("Unknown command")
+		}
+		rule = rule[:1] + name
+		if name == "@all" {
+			// overrides all previous command rules
+			u.commandRules = nil
+		}
+		u.commandRules = append(u.commandRules, rule)
+	default:
+		return fmt.Errorf("Syntax error")
+	}
+	return nil
+}
+
+func (u *aclUser) addPassword(hash string) {
+	u.nopass = false
+	for _, p := range u.passwords {
+		if p == hash {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, hash)
+}
+
+func (u *aclUser) removePassword(hash string) {
+	for i, p := range u.passwords {
+		if p == hash {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return
+		}
+	}
+}
+
+// checkPassword returns true if the password is one of the user's passwords
+func (u *aclUser) checkPassword(password string) bool {
+	if u.nopass {
+		return true
+	}
+	hash := []byte(hashPassword(password))
+	valid := false
+	for _, p := range u.passwords {
+		if subtle.ConstantTimeCompare(hash, []byte(p)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// canExecute returns true if the command rules allow a command with its arguments
+func (u *aclUser) canExecute(c *command, args [][]byte) bool {
+	allowed := false
+	for _, rule := range u.commandRules {
+		if matchesCommand(rule[1:], c, args) {
+			allowed = rule[0] == '+'
+		}
+	}
+	return allowed
+}
+
+// canAccess returns true if a key matches one of the user's key patterns
+func (u *aclUser) canAccess(key []byte) bool {
+	for _, pattern := range u.keyPatterns {
+		if matchPattern(pattern, string(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// rules returns the rules describing the user, as listed by ACL LIST
+func (u *aclUser) rules() []string {
+	rules := []string{"off"}
+	if u.enabled {
+		rules[0] = "on"
+	}
+	if u.nopass {
+		rules = append(rules, "nopass")
+	}
+	for _, p := range u.passwords {
+		rules = append(rules, "#"+p)
+	}
+	for _, pattern := range u.keyPatterns {
+		rules = append(rules, "~"+pattern)
+	}
+	return append(rules, u.commandRules...)
+}
+
+// matchesCommand returns true if a command rule name (e.g.: get, @read or select|1) matches a command
+func matchesCommand(name string, c *command, args [][]byte) bool {
+	if name == "@all" || name == c.name {
+		return true
+	}
+	if i := strings.Index(name, "|"); i >= 0 {
+		return name[:i] == c.name && len(args) > 1 && strings.EqualFold(name[i+1:], string(args[1]))
+	}
+	for _, category := range c.categories {
+		if category == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validCategory returns true if a category is used by one of the commands
+func validCategory(category string) bool {
+	if category == "@all" {
+		return true
+	}
+	for _, c := range commands {
+		for _, cat := range c.categories {
+			if cat == category {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hashPassword(password string) string {
+	hash := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(hash[:])
+}
+
+func validPasswordHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// getACLUser returns a user by name
+func getACLUser(name string) (*aclUser, bool) {
+	aclUsersLock.RLock()
+	defer aclUsersLock.RUnlock()
+	u, ok := aclUsers[name]
+	return u, ok
+}
+
+// authenticateUser checks the password of an enabled user
+func authenticateUser(name, password string) bool {
+	u, ok := getACLUser(name)
+	return ok && u.enabled && u.checkPassword(password)
+}
+
+// userAuthorized checks if an ACL user is allowed to execute a command
+// an error is written to the connection when it isn't
+func userAuthorized(conn redcon.Conn, name string, c *command, cmd redcon.Command) bool {
+	u, ok := getACLUser(name)
+	if !ok || !u.enabled {
+		conn.WriteError("NOPERM user '" + name + "' was deleted or disabled")
+		return false
+	}
+	if !u.canExecute(c, cmd.Args) {
+		conn.WriteError("NOPERM this user has no permissions to run the '" + c.name + "' command")
+		return false
+	}
+	for _, key := range c.keys(cmd.Args) {
+		if !u.canAccess(key) {
+			conn.WriteError("NOPERM this user has no permissions to access one of the keys used as arguments")
+			return false
+		}
+	}
+	return true
+}
+
+// setACLUser creates or modifies a user
+// the user is untouched when one of the rules is invalid
+func setACLUser(name string, rules []string) error {
+	aclUsersLock.Lock()
+	defer aclUsersLock.Unlock()
+
+	u, ok := aclUsers[name]
+	if ok {
+		u = u.copy()
+	} else {
+		u = newACLUser(name)
+	}
+	err := u.apply(rules)
+	if err != nil {
+		return err
+	}
+	aclUsers[name] = u
+	return nil
+}
+
+// deleteACLUsers deletes users and returns the amount of deleted users
+func deleteACLUsers(names []string) int {
+	aclUsersLock.Lock()
+	defer aclUsersLock.Unlock()
+
+	deleted := 0
+	for _, name := range names {
+		if _, ok := aclUsers[name]; ok {
+			delete(aclUsers, name)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// listACLUsers returns the users, sorted by name, in the ACL file format
+func listACLUsers() []string {
+	aclUsersLock.RLock()
+	defer aclUsersLock.RUnlock()
+
+	lines := make([]string, 0, len(aclUsers))
+	for _, u := range aclUsers {
+		lines = append(lines, "user "+u.name+" "+strings.Join(u.rules(), " "))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// parseACLFile parses users in the ACL file format
+// each line defines a user: user <name> [rules ...]
+func parseACLFile(data []byte) (map[string]*aclUser, error) {
+	users := make(map[string]*aclUser)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNr := 0
+	for scanner.Scan() {
+		lineNr++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return nil, fmt.Errorf("line %d should start with user <name>", lineNr)
+		}
+		if _, ok := users[fields[1]]; ok {
+			return nil, fmt.Errorf("line %d: duplicate user '%s'", lineNr, fields[1])
+		}
+		u := newACLUser(fields[1])
+		err := u.apply(fields[2:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNr, err)
+		}
+		users[u.name] = u
+	}
+	return users, scanner.Err()
+}
+
+// loadACLFile replaces the users with the ones of an ACL file
+// the users are untouched when the file is invalid
+func loadACLFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	users, err := parseACLFile(data)
+	if err != nil {
+		return err
+	}
+
+	aclUsersLock.Lock()
+	aclUsers = users
+	aclUsersLock.Unlock()
+	log.Infof("Loaded %d ACL users from %s", len(users), path)
+	return nil
+}
+
+// saveACLFile writes the users to an ACL file
+// the file is written to a temporary file first, so it is never partially written
+func saveACLFile(path string) error {
+	var buf bytes.Buffer
+	for _, line := range listACLUsers() {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// matchPattern matches a string against a glob-style pattern
+// supporting *, ?, [...] character classes and \ escapes
+func matchPattern(pattern, str string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(str); i++ {
+				if matchPattern(pattern[1:], str[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+			str = str[1:]
+		case '[':
+			if len(str) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				// unterminated class matches literally
+				if str[0] != '[' {
+					return false
+				}
+				str = str[1:]
+				break
+			}
+			class := pattern[1 : end+1]
+			if !matchClass(class, str[0]) {
+				return false
+			}
+			str = str[1:]
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(str) == 0 || str[0] != pattern[0] {
+				return false
+			}
+			str = str[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(str) == 0
+}
+
+// matchClass matches a character against a character class (e.g.: a-z or ^0-9)
+func matchClass(class string, c byte) bool {
+	negate := strings.HasPrefix(class, "^")
+	if negate {
+		class = class[1:]
+	}
+	match := false
+	for i := 0; i < len(class); i++ {
+		if i+2 < len(class) && class[i+1] == '-' {
+			if class[i] <= c && c <= class[i+2] {
+				match = true
+			}
+			i += 2
+			continue
+		}
+		if class[i] == c {
+			match = true
+		}
+	}
+	return match != negate
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+)
+
+func TestACLUserRules(t *testing.T) {
+	assert := assert.New(t)
+	u := newACLUser("alice")
+
+	err := u.apply([]string{"on", ">secret", "~cache:*", "+@read", "-exists"})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.True(u.enabled)
+	assert.True(u.checkPassword("secret"))
+	assert.False(u.checkPassword("wrong"))
+	assert.True(u.canExecute(commands["get"], nil))
+	assert.False(u.canExecute(commands["exists"], nil))
+	assert.False(u.canExecute(commands["set"], nil))
+	assert.True(u.canAccess([]byte("cache:foo")))
+	assert.False(u.canAccess([]byte("foo")))
+
+	// passwords are only kept hashed
+	assert.Equal([]string{"on", "#" + hashPassword("secret"), "~cache:*", "-@all", "+@read", "-exists"}, u.rules())
+
+	// +@all overrides the previous command rules
+	assert.NoError(u.apply([]string{"+@all", "<secret", "nopass"}))
+	assert.Equal([]string{"+@all"}, u.commandRules)
+	assert.True(u.canExecute(commands["set"], nil))
+	assert.True(u.checkPassword("anything"))
+
+	assert.NoError(u.apply([]string{"reset"}))
+	assert.Equal(newACLUser("alice"), u)
+
+	assert.Error(u.apply([]string{"+foo"}), "unknown command")
+	assert.Error(u.apply([]string{"+@foo"}), "unknown category")
+	assert.Error(u.apply([]string{"#abc"}), "invalid hash")
+	assert.Error(u.apply([]string{"foo"}), "syntax error")
+	assert.Error(u.apply([]string{"-select|1"}), "disallowed first argument")
+	assert.Error(u.apply([]string{"+@read|1"}), "first argument of a category")
+
+	// a first argument rule only allows the command with that argument
+	assert.NoError(u.apply([]string{"+select|1"}))
+	assert.True(u.canExecute(commands["select"], [][]byte{[]byte("SELECT"), []byte("1")}))
+	assert.False(u.canExecute(commands["select"], [][]byte{[]byte("SELECT"), []byte("2")}))
+}
+
+func TestSetACLUserAtomic(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { aclUsers = make(map[string]*aclUser) }()
+
+	assert.NoError(setACLUser("bob", []string{"on", ">pass"}))
+	assert.Error(setACLUser("bob", []string{"off", "+foo"}))
+	assert.True(authenticateUser("bob", "pass"), "user should be untouched by invalid rules")
+
+	assert.Equal(1, deleteACLUsers([]string{"bob", "carol"}))
+	assert.False(authenticateUser("bob", "pass"))
+}
+
+func TestMatchPattern(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(matchPattern("*", "anything"))
+	assert.True(matchPattern("user:*", "user:1"))
+	assert.True(matchPattern("user:*:name", "user:1/a:name"))
+	assert.False(matchPattern("user:*", "users"))
+	assert.True(matchPattern("h?llo", "hello"))
+	assert.False(matchPattern("h?llo", "hllo"))
+	assert.True(matchPattern("h[ae]llo", "hallo"))
+	assert.False(matchPattern("h[ae]llo", "hillo"))
+	assert.True(matchPattern("h[^e]llo", "hallo"))
+	assert.True(matchPattern("key[0-9]", "key5"))
+	assert.False(matchPattern("key[0-9]", "keya"))
+	assert.True(matchPattern(`star\*`, "star*"))
+	assert.False(matchPattern(`star\*`, "stars"))
+}
+
+func TestACLFile(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { aclUsers = make(map[string]*aclUser) }()
+	dir, err := ioutil.TempDir("", "zedis_acl")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.acl")
+
+	assert.NoError(setACLUser("alice", []string{"on", ">secret", "allkeys", "+@read"}))
+	assert.NoError(setACLUser("bob", []string{"off", "nopass"}))
+	assert.NoError(saveACLFile(path))
+	saved := listACLUsers()
+
+	deleteACLUsers([]string{"alice", "bob"})
+	assert.NoError(loadACLFile(path))
+	assert.Equal(saved, listACLUsers())
+	assert.True(authenticateUser("alice", "secret"))
+
+	// invalid files don't replace the users
+	assert.NoError(ioutil.WriteFile(path, []byte("user carol on\nuser dave +foo\n"), 0600))
+	assert.Error(loadACLFile(path))
+	assert.Equal(saved, listACLUsers())
+
+	_, err = parseACLFile([]byte("user carol on\nuser carol off\n"))
+	assert.Error(err, "duplicate user")
+	_, err = parseACLFile([]byte("carol on\n"))
+	assert.Error(err, "missing user keyword")
+}
+
+func TestAuthUser(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { aclUsers = make(map[string]*aclUser) }()
+	permissionValidator = stubAuthValidatorErr
+	storClient = newStubStorClient()
+	assert.NoError(setACLUser("alice", []string{"on", ">secret", "~cache:*", "+@read", "+set"}))
+	conn := new(stubConn)
+
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("AUTH"), []byte("alice"), []byte("wrong")}})
+	assert.Equal("WRONGPASS invalid username-password pair or user is disabled.", conn.s)
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("AUTH"), []byte("alice"), []byte("secret")}})
+	assert.Equal("OK", conn.s)
+
+	// the user's rules are checked instead of the JWT
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("SET"), []byte("cache:a"), []byte("value")}})
+	assert.Equal("OK", conn.s)
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("GET"), []byte("cache:a")}})
+	assert.Equal("value", conn.s)
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("EXISTS"), []byte("cache:a"), []byte("other")}})
+	assert.Equal("NOPERM this user has no permissions to access one of the keys used as arguments", conn.s)
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("SLOWLOG"), []byte("LEN")}})
+	assert.Equal("NOPERM this user has no permissions to run the 'slowlog' command", conn.s)
+
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("ACL"), []byte("WHOAMI")}})
+	assert.Equal("NOPERM this user has no permissions to run the 'acl' command", conn.s)
+	assert.NoError(setACLUser("alice", []string{"+acl"}))
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("ACL"), []byte("WHOAMI")}})
+	assert.Equal("alice", conn.s)
+
+	// the rules apply whatever the auth commands, and limit the databases
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.AuthCommands = map[string]struct{}{}
+	setZConfig(&cfg)
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("GET"), []byte("other")}})
+	assert.Equal("NOPERM this user has no permissions to access one of the keys used as arguments", conn.s)
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("SELECT"), []byte("1")}})
+	assert.Equal("NOPERM this user has no permissions to run the 'select' command", conn.s)
+	assert.NoError(setACLUser("alice", []string{"+select|0"}))
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("SELECT"), []byte("0")}})
+	assert.Equal("OK", conn.s)
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("SELECT"), []byte("1")}})
+	assert.Equal("NOPERM this user has no permissions to run the 'select' command", conn.s)
+
+	// changes to the user apply to authenticated connections
+	assert.NoError(setACLUser("alice", []string{"off"}))
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("GET"), []byte("cache:a")}})
+	assert.Equal("NOPERM user 'alice' was deleted or disabled", conn.s)
+}
+
+func TestACLCmd(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { aclUsers = make(map[string]*aclUser) }()
+	permissionValidator = stubAuthValidator
+	conn := new(recordConn)
+	getClient(conn).jwt = "aJWT"
+
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("ACL"), []byte("SETUSER"), []byte("bob"), []byte("on"), []byte("#" + hashPassword("pw"))}})
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("ACL"), []byte("SETUSER"), []byte("bob"), []byte("+foo")}})
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("ACL"), []byte("LIST")}})
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("ACL"), []byte("WHOAMI")}})
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("ACL"), []byte("DELUSER"), []byte("bob"), []byte("carol")}})
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("ACL"), []byte("SAVE")}})
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("ACL"), []byte("FOO")}})
+	assert.Equal([]string{
+		"OK",
+		"ERR Error in ACL SETUSER modifier '+foo': Unknown command",
+		"*1", "user bob on #" + hashPassword("pw") + " -@all",
+		"default",
+		"1",
+		"ERR This Zedis instance is not configured to use an ACL file. Set acl_file in the config.",
+		"ERR unknown subcommand 'FOO'. Try ACL SETUSER, DELUSER, LIST, WHOAMI, LOAD or SAVE.",
+	}, conn.replies)
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zero-os/zedis/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACME (let's encrypt) certificate manager of the TLS config, nil when ACME isn't used
+var acmeCertManager *autocert.Manager
+
+// listenAndServeACMEHTTP answers ACME HTTP-01 challenges over HTTP
+func listenAndServeACMEHTTP(addr string, m *autocert.Manager) error {
+	return http.ListenAndServe(addr, acmeHTTPHandler(m))
+}
+
+// acmeHTTPHandler answers ACME HTTP-01 challenges, other requests are answered with 404
+func acmeHTTPHandler(m *autocert.Manager) http.Handler {
+	return m.HTTPHandler(http.NotFoundHandler())
+}
+
+// acmeManager returns the ACME (let's encrypt) certificate manager of a Zedis config
+func acmeManager(zc *config.Zedis) (*autocert.Manager, error) {
+	m := &autocert.Manager{
+		Prompt: autocert.AcceptTOS,
+		Email:  zc.ACMEEmail,
+	}
+	m.HostPolicy = acmeHostPolicy
+	if zc.ACMECacheDir != "" {
+		m.Cache = autocert.DirCache(zc.ACMECacheDir)
+	}
+
+	if zc.ACMEDirectoryURL != "" || zc.ACMEDirectoryCAFile != "" {
+		m.Client = &acme.Client{DirectoryURL: zc.ACMEDirectoryURL}
+	}
+	if zc.ACMEDirectoryCAFile != "" {
+		pem, err := ioutil.ReadFile(zc.ACMEDirectoryCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in acme_directory_ca_file " + zc.ACMEDirectoryCAFile)
+		}
+		m.Client.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}
+	}
+
+	return m, nil
+}
+
+// acmeHostPolicy allows the hostnames of the acme_whitelist of the running config
+// all hostnames are allowed when it's empty
+func acmeHostPolicy(ctx context.Context, host string) error {
+	whitelist := zConfig().ACMEWhitelist
+	if len(whitelist) == 0 {
+		return nil
+	}
+	return hostPatternPolicy(whitelist)(ctx, host)
+}
+
+// hostPatternPolicy returns a policy allowing the hostnames matching one of the patterns:
+// an exact hostname, *.domain matching a single subdomain level or .domain matching any subdomain
+func hostPatternPolicy(patterns []string) autocert.HostPolicy {
+	return func(_ context.Context, host string) error {
+		host = strings.ToLower(host)
+		for _, pattern := range patterns {
+			if matchHostPattern(strings.ToLower(pattern), host) {
+				return nil
+			}
+		}
+		return fmt.Errorf("acme/autocert: host %q not configured in acme_whitelist", host)
+	}
+}
+
+func matchHostPattern(pattern, host string) bool {
+	switch {
+	case strings.HasPrefix(pattern, "*."):
+		sub := strings.TrimSuffix(host, pattern[1:])
+		return sub != host && sub != "" && !strings.Contains(sub, ".")
+	case strings.HasPrefix(pattern, "."):
+		return strings.HasSuffix(host, pattern) && len(host) > len(pattern)
+	}
+	return pattern == host
+}
+
+var (
+	// leaf certificates served by the ACME manager, by server name
+	acmeLeaves     = make(map[string]servedLeaf)
+	acmeLeavesLock sync.Mutex
+	// how long a certificate counts as served after its last handshake
+	acmeLeafTTL = 24 * time.Hour
+)
+
+type servedLeaf struct {
+	leaf   *x509.Certificate
+	served time.Time
+}
+
+// recordACMELeaves remembers the leaf certificates returned by the GetCertificate of the ACME manager,
+// so the expiry metric can report on them
+func recordACMELeaves(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := getCertificate(hello)
+		if err != nil || cert == nil || acmeChallenge(hello) {
+			return cert, err
+		}
+		leaf := cert.Leaf
+		if leaf == nil && len(cert.Certificate) > 0 {
+			leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+		}
+		if leaf != nil {
+			acmeLeavesLock.Lock()
+			acmeLeaves[hello.ServerName] = servedLeaf{leaf: leaf, served: time.Now()}
+			acmeLeavesLock.Unlock()
+		}
+		return cert, nil
+	}
+}
+
+// acmeCertDaysLeft returns the days left before the first of the ACME certificates served recently expires
+func acmeCertDaysLeft() (float64, bool) {
+	acmeLeavesLock.Lock()
+	defer acmeLeavesLock.Unlock()
+	var first *x509.Certificate
+	for name, served := range acmeLeaves {
+		if time.Since(served.served) > acmeLeafTTL {
+			delete(acmeLeaves, name)
+			continue
+		}
+		if first == nil || served.leaf.NotAfter.Before(first.NotAfter) {
+			first = served.leaf
+		}
+	}
+	if first == nil {
+		return 0, false
+	}
+	return time.Until(first.NotAfter).Hours() / 24, true
+}
+
+// acmeChallenge returns true for the handshake of an ACME server verifying a domain with a TLS-ALPN challenge
+func acmeChallenge(hello *tls.ClientHelloInfo) bool {
+	return len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto
+}
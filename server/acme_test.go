@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-os/zedis/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestHostPatternPolicy(t *testing.T) {
+	assert := assert.New(t)
+	policy := hostPatternPolicy([]string{"zedis.org", "*.eu.zedis.org", ".us.zedis.org"})
+
+	for _, host := range []string{"zedis.org", "ZEDIS.org", "a.eu.zedis.org", "a.us.zedis.org", "a.b.us.zedis.org"} {
+		assert.NoError(policy(context.Background(), host), host)
+	}
+	for _, host := range []string{"www.zedis.org", "eu.zedis.org", "a.b.eu.zedis.org", "us.zedis.org", "aus.zedis.org", "zedis.org.evil"} {
+		assert.Error(policy(context.Background(), host), host)
+	}
+}
+
+func TestACMEManager(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis_acme")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// let's encrypt without cache by default
+	m, err := acmeManager(&config.Zedis{})
+	if assert.NoError(err) {
+		assert.Nil(m.Cache)
+		assert.Nil(m.Client)
+	}
+
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(ioutil.WriteFile(caFile, testCA(t), 0600))
+	zc := &config.Zedis{
+		ACMECacheDir:        filepath.Join(dir, "cache"),
+		ACMEDirectoryURL:    "https://localhost:14000/dir",
+		ACMEDirectoryCAFile: caFile,
+		ACMEEmail:           "ops@zedis.org",
+	}
+	m, err = acmeManager(zc)
+	if assert.NoError(err) {
+		assert.Equal(autocert.DirCache(zc.ACMECacheDir), m.Cache)
+		assert.Equal("https://localhost:14000/dir", m.Client.DirectoryURL)
+		assert.NotNil(m.Client.HTTPClient)
+		assert.Equal("ops@zedis.org", m.Email)
+	}
+
+	// the whitelist of the running config is used
+	defer func(whitelist []string) { zConfig().ACMEWhitelist = whitelist }(zConfig().ACMEWhitelist)
+	zConfig().ACMEWhitelist = nil
+	assert.NoError(m.HostPolicy(context.Background(), "a.zedis.org"), "all hosts are allowed without whitelist")
+	zConfig().ACMEWhitelist = []string{"*.zedis.org"}
+	assert.NoError(m.HostPolicy(context.Background(), "a.zedis.org"))
+	assert.Error(m.HostPolicy(context.Background(), "zedis.com"))
+
+	zc.ACMEDirectoryCAFile = filepath.Join(dir, "missing.pem")
+	_, err = acmeManager(zc)
+	assert.Error(err)
+}
+
+func TestACMEChallenges(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { acmeCertManager = nil }()
+
+	// TLS-ALPN challenges are answered on the TLS port
+	tlsCfg, err := tlsConfig(&config.Zedis{ACME: true})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal([]string{acme.ALPNProto}, tlsCfg.NextProtos)
+	if !assert.NotNil(acmeCertManager) {
+		return
+	}
+
+	// HTTP-01 challenges are answered over HTTP, other requests aren't
+	defer func(whitelist []string) { zConfig().ACMEWhitelist = whitelist }(zConfig().ACMEWhitelist)
+	zConfig().ACMEWhitelist = []string{"zedis.org"}
+	h := acmeHTTPHandler(acmeCertManager)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "http://zedis.org/", nil))
+	assert.Equal(404, rec.Code)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "http://zedis.com/.well-known/acme-challenge/token", nil))
+	assert.Equal(403, rec.Code, "challenge for a host outside the whitelist")
+
+	// the certificates of TLS-ALPN challenges don't count for the expiry metric
+	defer func() { acmeLeaves = make(map[string]servedLeaf) }()
+	ca, err := genCA()
+	if !assert.NoError(err) {
+		return
+	}
+	cert, err := ca.issue([]string{"zedis.org"})
+	if !assert.NoError(err) {
+		return
+	}
+	getCertificate := recordACMELeaves(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return cert, nil })
+	getCertificate(&tls.ClientHelloInfo{ServerName: "zedis.org", SupportedProtos: []string{acme.ALPNProto}})
+	assert.Empty(acmeLeaves)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// how often the TLS certificate files are checked for changes
+var certFileCheckInterval = 10 * time.Second
+
+// certFiles are the PEM encoded files the served TLS certificate is loaded from
+type certFiles struct {
+	cert  string
+	key   string
+	chain string
+}
+
+// load loads the certificate, followed by the certificates of the chain file
+func (f certFiles) load() (*tls.Certificate, error) {
+	certPEM, err := ioutil.ReadFile(f.cert)
+	if err != nil {
+		return nil, err
+	}
+	if f.chain != "" {
+		chainPEM, err := ioutil.ReadFile(f.chain)
+		if err != nil {
+			return nil, err
+		}
+		certPEM = append(append(certPEM, '\n'), chainPEM...)
+	}
+	keyPEM, err := ioutil.ReadFile(f.key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// state describes the modification times and sizes of the files, it changes when a file changes
+func (f certFiles) state() string {
+	var state bytes.Buffer
+	for _, path := range []string{f.cert, f.key, f.chain} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(&state, "%s missing\n", path)
+			continue
+		}
+		fmt.Fprintf(&state, "%s %d %d\n", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return state.String()
+}
+
+// certFileWatcher reloads the served certificate when its files change
+func certFileWatcher(files certFiles) {
+	state := files.state()
+	ticker := time.NewTicker(certFileCheckInterval)
+	for range ticker.C {
+		state = reloadCertFiles(files, state)
+	}
+}
+
+// reloadCertFiles swaps the served certificate when the files changed since the given state
+// the current certificate keeps being served when the files are invalid (e.g. only the certificate is replaced yet)
+// returns the new state of the files
+func reloadCertFiles(files certFiles, state string) string {
+	newState := files.state()
+	if newState == state {
+		return state
+	}
+
+	cert, err := files.load()
+	if err != nil {
+		log.Errorf("failed to reload TLS certificate files, keeping the current certificate: %v", err)
+		return newState
+	}
+	certCacheLock.Lock()
+	certCache = cert
+	certCacheLock.Unlock()
+	log.Infof("Reloaded TLS certificate from %s", files.cert)
+	return newState
+}
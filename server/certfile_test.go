@@ -0,0 +1,103 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-os/zedis/config"
+)
+
+func TestCertFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis_certfiles")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	files := certFiles{
+		cert: filepath.Join(dir, "cert.pem"),
+		key:  filepath.Join(dir, "key.pem"),
+	}
+	first := writeCertFiles(t, files, time.Now().Add(-time.Hour))
+
+	tlsCfg, err := tlsConfig(&config.Zedis{
+		TLSCertFile:       files.cert,
+		TLSKeyFile:        files.key,
+		TLSMinVersionID:   tls.VersionTLS13,
+		TLSCipherSuiteIDs: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(uint16(tls.VersionTLS13), tlsCfg.MinVersion)
+	assert.Equal([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, tlsCfg.CipherSuites)
+	served, err := tlsCfg.GetCertificate(nil)
+	assert.NoError(err)
+	assert.Equal(first.Certificate, served.Certificate)
+
+	// unchanged files are not reloaded
+	state := files.state()
+	assert.Equal(state, reloadCertFiles(files, state))
+
+	// a replaced certificate is served without restart
+	second := writeCertFiles(t, files, time.Now())
+	state = reloadCertFiles(files, state)
+	served, _ = tlsCfg.GetCertificate(nil)
+	assert.Equal(second.Certificate, served.Certificate)
+
+	// invalid files keep the current certificate served
+	assert.NoError(ioutil.WriteFile(files.key, []byte("partially written"), 0600))
+	reloadCertFiles(files, state)
+	served, _ = tlsCfg.GetCertificate(nil)
+	assert.Equal(second.Certificate, served.Certificate)
+
+	// the chain is served after the certificate
+	files.chain = filepath.Join(dir, "chain.pem")
+	second = writeCertFiles(t, files, time.Now())
+	assert.NoError(ioutil.WriteFile(files.chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: first.Certificate[0]}), 0600))
+	cert, err := files.load()
+	if assert.NoError(err) && assert.Len(cert.Certificate, 2) {
+		assert.Equal(second.Certificate[0], cert.Certificate[0])
+		assert.Equal(first.Certificate[0], cert.Certificate[1])
+		assert.NotNil(cert.Leaf)
+	}
+}
+
+// writeCertFiles writes a new self signed certificate and key to the files, modified at the given time
+func writeCertFiles(t *testing.T, files certFiles, modTime time.Time) *tls.Certificate {
+	ca, err := genCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ca.issue([]string{"localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(files.cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(files.key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{files.cert, files.key} {
+		err = os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cert
+}
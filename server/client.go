@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/server/jwt"
+	"github.com/zero-os/zedis/stor"
+)
+
+var (
+	// state of the connected clients
+	clients     = make(map[redcon.Conn]*client)
+	clientsLock = new(sync.Mutex)
+)
+
+// client holds the server side state of a connection
+type client struct {
+	// name of the listener that accepted the connection
+	listener string
+	// set when the connection is counted for the client limits
+	admitted bool
+	// IP address of the connection, empty for Unix socket connections
+	host string
+	// address of the client and the address it connected to,
+	// as sent by the load balancer on listeners using the PROXY protocol
+	// guarded by lock when set, so other goroutines can read them
+	addr  string
+	laddr string
+	// JWT set with the AUTH command
+	// guarded by lock when set, so other goroutines can read it
+	jwt  string
+	lock sync.Mutex
+	// set atomically when the connection is closed for using a revoked JWT
+	cutOff int32
+	// ACL user authenticated with the AUTH command
+	user string
+	// subject claim of the JWT set with the AUTH command
+	jwtSubject string
+	// selected database
+	db int
+	// tenant the connection is routed to by its JWT
+	// empty when the connection uses the configured databases
+	tenant string
+	// set when the connection is detached to monitor commands
+	monitoring bool
+
+	// set once the client certificate of a TLS connection is looked up
+	certChecked bool
+	// scopes granted to the verified client certificate, nil when there is none
+	certScopes []string
+	// common name of the verified client certificate
+	certSubject string
+
+	// time spent in the 0-stor and validating JWTs
+	// while processing the current command
+	storTime time.Duration
+	jwtTime  time.Duration
+
+	// state replied by CLIENT LIST, guarded by lock
+	info clientInfo
+}
+
+// getClient returns the state of a connection
+// the state is created if the connection doesn't have one yet
+func getClient(conn redcon.Conn) *client {
+	// commands of a pipeline share the state of their connection
+	if pc, ok := conn.(*pipelinedConn); ok {
+		conn = pc.Conn
+	}
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	c, ok := clients[conn]
+	if !ok {
+		c = new(client)
+		clients[conn] = c
+	}
+	return c
+}
+
+// removeClient drops the state of a connection
+// an admitted connection no longer counts for the client limits
+func removeClient(conn redcon.Conn) {
+	clientsLock.Lock()
+	c, ok := clients[conn]
+	delete(clients, conn)
+	clientsLock.Unlock()
+	if ok {
+		releaseClient(c)
+	}
+}
+
+// remoteAddr returns the address of the client of a connection,
+// which is sent by the load balancer on listeners using the PROXY protocol
+func remoteAddr(conn redcon.Conn) string {
+	if addr := getClient(conn).getAddr(); addr != "" {
+		return addr
+	}
+	return conn.RemoteAddr()
+}
+
+// setAddrs sets the addresses sent by the load balancer
+func (c *client) setAddrs(addr, laddr string) {
+	c.lock.Lock()
+	c.addr = addr
+	c.laddr = laddr
+	c.lock.Unlock()
+}
+
+// getAddr returns the client address sent by the load balancer, if any,
+// safe to call from other goroutines than the connection's
+func (c *client) getAddr() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.addr
+}
+
+// setJWT sets the JWT of the connection
+func (c *client) setJWT(jwtStr string) {
+	c.lock.Lock()
+	c.jwt = jwtStr
+	c.lock.Unlock()
+}
+
+// getJWT returns the JWT of the connection,
+// safe to call from other goroutines than the connection's
+func (c *client) getJWT() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.jwt
+}
+
+// resetTimings clears the timings before processing a new command
+func (c *client) resetTimings() {
+	c.storTime = 0
+	c.jwtTime = 0
+}
+
+// commandTimings returns the time the command processed on a connection
+// spent in the 0-stor and validating JWTs
+func commandTimings(conn redcon.Conn) (storTime, jwtTime time.Duration) {
+	if pc, ok := conn.(*pipelinedConn); ok {
+		return pc.storTime, pc.jwtTime
+	}
+	c := getClient(conn)
+	return c.storTime, c.jwtTime
+}
+
+// validateJWT validates a JWT against the namespace of an organization
+// time spent validating is added to the client's command timings
+func (c *client) validateJWT(jwtStr, organization, namespace string, getExpectedScopes jwt.GetScopes) error {
+	defer func(start time.Time) {
+		c.jwtTime += time.Since(start)
+	}(time.Now())
+	return permissionValidator(jwtStr, organization, namespace, getExpectedScopes)
+}
+
+// scope returns the itsyou.online organization and namespace
+// of the tenant or selected database, the connection needs scopes of
+func (c *client) scope() (string, string) {
+	if c.tenant != "" {
+		return zConfig().Tenants.JWTOrganization, c.tenant
+	}
+	return zConfig().DatabaseJWTScope(c.db)
+}
+
+// commandScope returns the itsyou.online organization and namespace
+// the connection needs scopes of to execute a command
+// server commands affect all databases and tenants, so they always need scopes of database 0
+func (c *client) commandScope(cmd *command) (string, string) {
+	if cmd.serverWide() {
+		return zConfig().DatabaseJWTScope(0)
+	}
+	return c.scope()
+}
+
+// storFor returns the stor client of the tenant or database selected by a connection
+// time spent in the stor is added to the connection's command timings
+func storFor(conn redcon.Conn) stor.Client {
+	c := getClient(conn)
+	sc := storClient
+	switch {
+	case c.tenant != "":
+		// created when the connection authenticated
+		sc, _ = tenantStor(c.tenant)
+	case c.db != 0:
+		sc = dbStorClients[c.db]
+	}
+	storTime := &c.storTime
+	// commands of a pipeline can run concurrently and are timed separately
+	if pc, ok := conn.(*pipelinedConn); ok {
+		storTime = &pc.storTime
+	}
+	return tracedStor{
+		Client:   sc,
+		storTime: storTime,
+	}
+}
+
+// tracedStor adds the time spent in the 0-stor to a command's timings
+type tracedStor struct {
+	stor.Client
+	storTime *time.Duration
+}
+
+func (ts tracedStor) Read(ctx context.Context, key []byte) ([]byte, error) {
+	defer ts.track(time.Now())
+	return ts.Client.Read(ctx, key)
+}
+
+func (ts tracedStor) Write(ctx context.Context, key []byte, value []byte) error {
+	defer ts.track(time.Now())
+	return ts.Client.Write(ctx, key, value)
+}
+
+func (ts tracedStor) KeyExists(ctx context.Context, key []byte) (bool, error) {
+	defer ts.track(time.Now())
+	return ts.Client.KeyExists(ctx, key)
+}
+
+func (ts tracedStor) track(start time.Time) {
+	*ts.storTime += time.Since(start)
+}
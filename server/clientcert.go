@@ -0,0 +1,115 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/config"
+)
+
+// configureClientAuth makes a TLS config verify client certificates
+func configureClientAuth(tlsCfg *tls.Config, ca *config.TLSClientAuth) error {
+	if ca == nil {
+		return nil
+	}
+
+	pem, err := ioutil.ReadFile(ca.CAFile)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return errors.New("no certificates found in tls_client_auth ca_file " + ca.CAFile)
+	}
+	tlsCfg.ClientCAs = pool
+
+	switch ca.Mode {
+	case config.ClientAuthRequire:
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return nil
+}
+
+// certificateScopes returns the scopes granted to the verified client certificate of a TLS connection
+// returns nil when the connection has no such certificate
+func (c *client) certificateScopes(conn redcon.Conn) []string {
+	if c.certChecked || zConfig().TLSClientAuth == nil {
+		return c.certScopes
+	}
+
+	// the handshake is done by the time a command is read
+	tlsConn, ok := conn.NetConn().(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	c.certChecked = true
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 {
+		return nil
+	}
+
+	cert := state.PeerCertificates[0]
+	c.certSubject = cert.Subject.CommonName
+	c.certScopes = certScopes(cert, zConfig().TLSClientAuth.Identities)
+	if c.certScopes == nil {
+		// verified, but without identity
+		c.certScopes = []string{}
+	}
+	log.Debugf("client certificate %q of %s granted scopes %v", cert.Subject.CommonName, remoteAddr(conn), c.certScopes)
+	return c.certScopes
+}
+
+// certScopes returns the scopes of all identities a certificate matches
+func certScopes(cert *x509.Certificate, identities []config.CertIdentity) []string {
+	var scopes []string
+	for _, identity := range identities {
+		if certMatches(cert, identity) {
+			scopes = append(scopes, identity.Scopes...)
+		}
+	}
+	return scopes
+}
+
+// certMatches returns true if all set fields of an identity match the certificate
+func certMatches(cert *x509.Certificate, identity config.CertIdentity) bool {
+	if identity.CommonName != "" && identity.CommonName != cert.Subject.CommonName {
+		return false
+	}
+	if identity.Organization != "" && !contains(cert.Subject.Organization, identity.Organization) {
+		return false
+	}
+	if identity.OrganizationalUnit != "" && !contains(cert.Subject.OrganizationalUnit, identity.OrganizationalUnit) {
+		return false
+	}
+	if identity.DNSName != "" && !contains(cert.DNSNames, identity.DNSName) {
+		return false
+	}
+	if identity.Email != "" && !contains(cert.EmailAddresses, identity.Email) {
+		return false
+	}
+	if identity.URI != "" {
+		var uris []string
+		for _, uri := range cert.URIs {
+			uris = append(uris, uri.String())
+		}
+		if !contains(uris, identity.URI) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
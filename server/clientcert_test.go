@@ -0,0 +1,135 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/config"
+)
+
+func TestCertScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	uri, _ := url.Parse("spiffe://zedis/backup")
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "backup",
+			Organization:       []string{"zedis"},
+			OrganizationalUnit: []string{"ops"},
+		},
+		DNSNames:       []string{"backup.zedis.org"},
+		EmailAddresses: []string{"ops@zedis.org"},
+		URIs:           []*url.URL{uri},
+	}
+	identities := []config.CertIdentity{
+		{CommonName: "backup", Scopes: []string{"org.ns.read"}},
+		{Organization: "zedis", OrganizationalUnit: "ops", Scopes: []string{"org.ns.write"}},
+		{DNSName: "backup.zedis.org", URI: "spiffe://zedis/backup", Email: "ops@zedis.org", Scopes: []string{"org.other"}},
+		{CommonName: "backup", Organization: "other", Scopes: []string{"org.ns"}},
+		{DNSName: "other.zedis.org", Scopes: []string{"org.ns"}},
+	}
+
+	assert.Equal([]string{"org.ns.read", "org.ns.write", "org.other"}, certScopes(cert, identities))
+	assert.Nil(certScopes(&x509.Certificate{}, identities))
+}
+
+func TestCertificateAuthentication(t *testing.T) {
+	assert := assert.New(t)
+	zConfig().JWTOrganization = "org"
+	zConfig().JWTNamespace = "ns"
+	defer func() {
+		zConfig().JWTOrganization = ""
+		zConfig().JWTNamespace = ""
+	}()
+	storClient = newStubStorClient()
+
+	conn := new(stubConn)
+	defer removeClient(conn)
+	c := getClient(conn)
+	c.certChecked = true
+	c.certScopes = []string{"org.ns.read"}
+
+	set := redcon.Command{Args: [][]byte{[]byte("SET"), []byte("key"), []byte("value")}}
+	get := redcon.Command{Args: [][]byte{[]byte("GET"), []byte("key")}}
+
+	dispatch(conn, set)
+	assert.Equal(certMissingScopeMsg, conn.s)
+	dispatch(conn, get)
+	assert.Equal("ERR reading from the stor: key was not found", conn.s, "read scope should allow GET")
+
+	// a verified certificate without identity has no scopes
+	c.certScopes = []string{}
+	dispatch(conn, get)
+	assert.Equal(certMissingScopeMsg, conn.s)
+
+	// a JWT takes precedence over the certificate
+	permissionValidator = stubAuthValidator
+	c.jwt = "aJWT"
+	dispatch(conn, set)
+	assert.Equal("OK", conn.s)
+}
+
+func TestConfigureClientAuth(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis_clientauth")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	tlsCfg := new(tls.Config)
+	assert.NoError(configureClientAuth(tlsCfg, nil))
+	assert.Equal(tls.NoClientCert, tlsCfg.ClientAuth)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := &config.TLSClientAuth{Mode: config.ClientAuthRequire, CAFile: caFile}
+	assert.Error(configureClientAuth(tlsCfg, ca), "missing CA file")
+
+	assert.NoError(ioutil.WriteFile(caFile, []byte("not a certificate"), 0600))
+	assert.Error(configureClientAuth(tlsCfg, ca), "no certificates in CA file")
+
+	assert.NoError(ioutil.WriteFile(caFile, testCA(t), 0600))
+	assert.NoError(configureClientAuth(tlsCfg, ca))
+	assert.Equal(tls.RequireAndVerifyClientCert, tlsCfg.ClientAuth)
+	assert.NotNil(tlsCfg.ClientCAs)
+
+	ca.Mode = config.ClientAuthVerifyIfGiven
+	assert.NoError(configureClientAuth(tlsCfg, ca))
+	assert.Equal(tls.VerifyClientCertIfGiven, tlsCfg.ClientAuth)
+}
+
+// testCA returns a PEM encoded self signed CA certificate
+func testCA(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "zedis test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
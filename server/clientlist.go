@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+)
+
+// id of the last accepted connection
+var lastClientID int64
+
+// clientInfo is the state of a connection replied by CLIENT LIST
+type clientInfo struct {
+	id       int64
+	addr     string
+	laddr    string
+	listener string
+	created  time.Time
+	// last processed command
+	cmd     string
+	lastCmd time.Time
+	db      int
+	user    string
+}
+
+// registerClient gives an accepted connection an id and lists it in CLIENT LIST
+func registerClient(conn redcon.Conn) {
+	c := getClient(conn)
+	info := clientInfo{
+		id:       atomic.AddInt64(&lastClientID, 1),
+		addr:     remoteAddr(conn),
+		laddr:    c.laddr,
+		listener: c.listener,
+		created:  time.Now(),
+		user:     "default",
+	}
+	if netConn := conn.NetConn(); info.laddr == "" && netConn != nil {
+		info.laddr = netConn.LocalAddr().String()
+	}
+	info.lastCmd = info.created
+
+	c.lock.Lock()
+	c.info = info
+	c.lock.Unlock()
+}
+
+// recordCommand updates the state of a connection after processing a command
+func (c *client) recordCommand(name string) {
+	user := c.user
+	if user == "" {
+		user = "default"
+	}
+	c.lock.Lock()
+	c.info.cmd = name
+	c.info.lastCmd = time.Now()
+	c.info.db = c.db
+	c.info.user = user
+	c.lock.Unlock()
+}
+
+// listClients returns the state of the accepted connections, ordered by id
+func listClients() []clientInfo {
+	clientsLock.Lock()
+	all := make([]*client, 0, len(clients))
+	for _, c := range clients {
+		all = append(all, c)
+	}
+	clientsLock.Unlock()
+
+	infos := make([]clientInfo, 0, len(all))
+	for _, c := range all {
+		c.lock.Lock()
+		info := c.info
+		c.lock.Unlock()
+		if info.id != 0 {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].id < infos[j].id })
+	return infos
+}
+
+// clientListLine formats the state of a connection the way Redis CLIENT LIST does
+// e.g.: id=3 addr=127.0.0.1:60866 laddr=127.0.0.1:6380 listener=plain age=8 idle=0 db=0 user=default cmd=get
+func clientListLine(info clientInfo, now time.Time) string {
+	cmd := info.cmd
+	if cmd == "" {
+		cmd = "NULL"
+	}
+	return "id=" + strconv.FormatInt(info.id, 10) +
+		" addr=" + info.addr +
+		" laddr=" + info.laddr +
+		" listener=" + info.listener +
+		" age=" + strconv.FormatInt(int64(now.Sub(info.created).Seconds()), 10) +
+		" idle=" + strconv.FormatInt(int64(now.Sub(info.lastCmd).Seconds()), 10) +
+		" db=" + strconv.Itoa(info.db) +
+		" user=" + info.user +
+		" cmd=" + cmd
+}
+
+func clientCmd(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received CLIENT command from %s", remoteAddr(conn))
+
+	switch strings.ToUpper(string(cmd.Args[1])) {
+	case "LIST":
+		if len(cmd.Args) != 2 {
+			wrongArgCount(conn, cmd)
+			return
+		}
+		var b bytes.Buffer
+		now := time.Now()
+		for _, info := range listClients() {
+			b.WriteString(clientListLine(info, now))
+			b.WriteByte('\n')
+		}
+		conn.WriteBulk(b.Bytes())
+	case "ID":
+		if len(cmd.Args) != 2 {
+			wrongArgCount(conn, cmd)
+			return
+		}
+		conn.WriteInt64(getClient(conn).info.id)
+	default:
+		conn.WriteError("ERR unknown subcommand '" + string(cmd.Args[1]) + "'. Try CLIENT LIST or ID.")
+	}
+}
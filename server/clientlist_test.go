@@ -0,0 +1,55 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+)
+
+func TestClientCmd(t *testing.T) {
+	assert := assert.New(t)
+
+	listed := new(addrConn)
+	listed.addr = "192.0.2.1:56324"
+	defer removeClient(listed)
+	getClient(listed).listener = "plain"
+	registerClient(listed)
+	getClient(listed).db = 2
+	getClient(listed).recordCommand("select")
+	unlisted := new(stubConn)
+	defer removeClient(unlisted)
+	getClient(unlisted)
+
+	conn := new(recordConn)
+	defer removeClient(conn)
+	registerClient(conn)
+	clientCmd(conn, redcon.Command{Args: [][]byte{[]byte("CLIENT"), []byte("LIST")}})
+	if assert.Len(conn.replies, 1) {
+		lines := strings.Split(strings.TrimSuffix(conn.replies[0], "\n"), "\n")
+		assert.Len(lines, 2, "connections that weren't accepted are not listed")
+		assert.Contains(lines[0], " addr=192.0.2.1:56324 ")
+		assert.Contains(lines[0], " db=2 user=default cmd=select")
+	}
+
+	conn.replies = nil
+	clientCmd(conn, redcon.Command{Args: [][]byte{[]byte("CLIENT"), []byte("ID")}})
+	assert.Equal([]string{strconv.FormatInt(getClient(conn).info.id, 10)}, conn.replies)
+
+	conn.replies = nil
+	clientCmd(conn, redcon.Command{Args: [][]byte{[]byte("CLIENT"), []byte("KILL")}})
+	assert.Equal([]string{"ERR unknown subcommand 'KILL'. Try CLIENT LIST or ID."}, conn.replies)
+}
+
+func TestClientListLine(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	info := clientInfo{
+		id: 3, addr: "127.0.0.1:60866", laddr: "127.0.0.1:6380", listener: "plain",
+		created: now.Add(-8 * time.Second), lastCmd: now, user: "default",
+	}
+	assert.Equal("id=3 addr=127.0.0.1:60866 laddr=127.0.0.1:6380 listener=plain age=8 idle=0 db=0 user=default cmd=NULL", clientListLine(info, now))
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/server/jwt"
+)
+
+// commands supported by zedis, indexed by lower case name
+var commands map[string]*command
+
+// command describes a command supported by zedis
+type command struct {
+	name string
+	// exact amount of arguments, including the command name, when positive
+	// minimum amount of arguments when negative
+	arity int
+	// flags as replied by COMMAND
+	flags []string
+	// argument positions of the keys
+	// lastKey is negative when counting from the last argument
+	firstKey int
+	lastKey  int
+	keyStep  int
+	// ACL categories, used to look up the required scope in the auth policy
+	// the first category found in the policy is used
+	categories []string
+	// command never requires authentication
+	noAuth bool
+	// command requires authentication regardless of the configured auth commands
+	alwaysAuth bool
+	// command only reads from the 0-stor and can run concurrently
+	// with its neighbours in a pipeline
+	concurrent bool
+	// documentation replied by COMMAND DOCS
+	summary string
+	since   string
+	group   string
+
+	handler func(conn redcon.Conn, cmd redcon.Command)
+}
+
+func init() {
+	// defined in init as COMMAND references the table
+	table := []*command{
+		{
+			name: "ping", arity: -1, flags: []string{"stale", "fast"},
+			categories: []string{"@fast", "@connection"}, noAuth: true,
+			summary: "Returns the server's liveliness response.", since: "1.0.0", group: "connection",
+			handler: ping,
+		},
+		{
+			name: "quit", arity: -1, flags: []string{"loading", "stale", "fast"},
+			categories: []string{"@fast", "@connection"}, noAuth: true,
+			summary: "Closes the connection.", since: "1.0.0", group: "connection",
+			handler: quit,
+		},
+		{
+			name: "auth", arity: -2, flags: []string{"noscript", "loading", "stale", "fast"},
+			categories: []string{"@fast", "@connection"}, noAuth: true,
+			summary: "Authenticates the connection with a JWT or an ACL user.", since: "1.0.0", group: "connection",
+			handler: auth,
+		},
+		{
+			name: "select", arity: 2, flags: []string{"loading", "stale", "fast"},
+			categories: []string{"@fast", "@connection"}, noAuth: true,
+			summary: "Changes the selected database.", since: "1.0.0", group: "connection",
+			handler: selectCmd,
+		},
+		{
+			name: "get", arity: 2, flags: []string{"readonly", "fast"},
+			firstKey: 1, lastKey: 1, keyStep: 1,
+			categories: []string{"@read", "@string", "@fast"},
+			summary:    "Returns the string value of a key.", since: "1.0.0", group: "string",
+			concurrent: true,
+			handler:    get,
+		},
+		{
+			name: "set", arity: 3, flags: []string{"write", "denyoom"},
+			firstKey: 1, lastKey: 1, keyStep: 1,
+			categories: []string{"@write", "@string", "@slow"},
+			summary:    "Sets the string value of a key.", since: "1.0.0", group: "string",
+			handler: set,
+		},
+		{
+			name: "exists", arity: -2, flags: []string{"readonly", "fast"},
+			firstKey: 1, lastKey: -1, keyStep: 1,
+			categories: []string{"@read", "@keyspace", "@fast"},
+			summary:    "Determines how many of the keys exist.", since: "1.0.0", group: "keyspace",
+			concurrent: true,
+			handler:    exists,
+		},
+		{
+			name: "slowlog", arity: -2, flags: []string{"admin", "random", "loading", "stale"},
+			categories: []string{"@admin", "@slow", "@dangerous"}, alwaysAuth: true,
+			summary: "Inspects the commands that exceeded the latency threshold.", since: "2.2.12", group: "server",
+			handler: slowlogCmd,
+		},
+		{
+			name: "info", arity: -1, flags: []string{"random", "loading", "stale"},
+			categories: []string{"@slow", "@dangerous"},
+			summary:    "Returns information and statistics about the server.", since: "1.0.0", group: "server",
+			handler: infoCmd,
+		},
+		{
+			name: "monitor", arity: 1, flags: []string{"admin", "noscript", "loading", "stale"},
+			categories: []string{"@admin", "@slow", "@dangerous"}, alwaysAuth: true,
+			summary: "Listens for all requests received by the server in real-time.", since: "1.0.0", group: "server",
+			handler: monitorCmd,
+		},
+		{
+			name: "acl", arity: -2, flags: []string{"admin", "noscript", "loading", "stale"},
+			categories: []string{"@admin", "@slow", "@dangerous"}, alwaysAuth: true,
+			summary: "Manages the local ACL users.", since: "6.0.0", group: "server",
+			handler: aclCmd,
+		},
+		{
+			name: "revoke", arity: -2, flags: []string{"admin", "noscript", "loading", "stale"},
+			categories: []string{"@admin", "@slow", "@dangerous"}, alwaysAuth: true,
+			summary: "Revokes JWTs and closes the connections using them.", since: "1.0.0", group: "server",
+			handler: revokeCmd,
+		},
+		{
+			name: "config", arity: -2, flags: []string{"admin", "noscript", "loading", "stale"},
+			categories: []string{"@admin", "@slow", "@dangerous"}, alwaysAuth: true,
+			summary: "Manages the configuration of the running server.", since: "2.0.0", group: "server",
+			handler: configCmd,
+		},
+		{
+			name: "client", arity: -2, flags: []string{"admin", "noscript", "random", "loading", "stale"},
+			categories: []string{"@admin", "@slow", "@dangerous"}, alwaysAuth: true,
+			summary: "Inspects the client connections.", since: "2.4.0", group: "connection",
+			handler: clientCmd,
+		},
+		{
+			name: "tlsca", arity: 2, flags: []string{"admin", "loading", "stale"},
+			categories: []string{"@admin", "@slow"}, alwaysAuth: true,
+			summary: "Returns the self signed TLS CA certificate or its fingerprint.", since: "1.0.0", group: "server",
+			handler: tlsCACmd,
+		},
+		{
+			name: "command", arity: -1, flags: []string{"random", "loading", "stale"},
+			categories: []string{"@slow", "@connection"}, noAuth: true,
+			summary: "Returns detailed information about the supported commands.", since: "2.8.13", group: "server",
+			handler: commandCmd,
+		},
+	}
+
+	commands = make(map[string]*command, len(table))
+	for _, c := range table {
+		commands[c.name] = c
+	}
+}
+
+// dispatch validates a command and calls its handler
+// returns the name of the command or "unknown" when not supported
+func dispatch(conn redcon.Conn, cmd redcon.Command) string {
+	c, ok := prepare(conn, cmd)
+	if c == nil {
+		return "unknown"
+	}
+	if ok {
+		c.handler(conn, cmd)
+	}
+	return c.name
+}
+
+// prepare looks up a command and checks its arguments, the listener's policy, authorization and rate limits
+// the command is nil when unknown, an error is written to the connection when it can't be executed
+func prepare(conn redcon.Conn, cmd redcon.Command) (*command, bool) {
+	c, ok := commands[strings.ToLower(string(cmd.Args[0]))]
+	if !ok {
+		unknown(conn, cmd)
+		return nil, false
+	}
+
+	if !c.validArgCount(len(cmd.Args)) {
+		wrongArgCount(conn, cmd)
+		return c, false
+	}
+
+	if !listenerAllows(conn, c) {
+		return c, false
+	}
+
+	if !authorized(conn, c, cmd) {
+		return c, false
+	}
+	return c, withinRateLimits(conn, c)
+}
+
+// wrongArgCount writes the error for a command with an invalid amount of arguments
+func wrongArgCount(conn redcon.Conn, cmd redcon.Command) {
+	conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+}
+
+// requiredScopes returns the scopes a JWT needs to execute the command
+// defined by the command's entry or first category entry in the auth policy
+// commands without a policy entry require the admin scope
+func (c *command) requiredScopes() jwt.GetScopes {
+	policy := zConfig().AuthPolicy
+	if suffix, ok := policy[c.name]; ok {
+		return jwt.SuffixScopes(suffix)
+	}
+	for _, category := range c.categories {
+		if suffix, ok := policy[category]; ok {
+			return jwt.SuffixScopes(suffix)
+		}
+	}
+	return jwt.AdminScopes
+}
+
+// serverWide returns true for commands that manage or inspect the whole server,
+// rather than the selected database or tenant
+func (c *command) serverWide() bool {
+	return c.alwaysAuth || contains(c.categories, "@admin") || contains(c.categories, "@dangerous")
+}
+
+// validArgCount checks if the amount of arguments matches the command's arity
+func (c *command) validArgCount(argc int) bool {
+	if c.arity < 0 {
+		return argc >= -c.arity
+	}
+	return argc == c.arity
+}
+
+// keys returns the keys in the arguments of the command
+func (c *command) keys(args [][]byte) [][]byte {
+	if c.firstKey <= 0 || c.firstKey >= len(args) {
+		return nil
+	}
+	last := c.lastKey
+	if last < 0 {
+		last = len(args) + last
+	}
+	if last >= len(args) {
+		last = len(args) - 1
+	}
+
+	var keys [][]byte
+	for i := c.firstKey; i <= last; i += c.keyStep {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// redactArgs returns the arguments of a command with the secrets redacted,
+// used when logging and monitoring commands
+func redactArgs(args [][]byte) [][]byte {
+	switch strings.ToUpper(string(args[0])) {
+	case "AUTH":
+		return [][]byte{args[0], []byte("(redacted)")}
+	case "ACL":
+		if len(args) < 3 || strings.ToUpper(string(args[1])) != "SETUSER" {
+			return args
+		}
+		redacted := make([][]byte, len(args))
+		copy(redacted, args)
+		for i := 3; i < len(redacted); i++ {
+			// passwords to add or remove
+			if arg := redacted[i]; len(arg) > 0 && (arg[0] == '>' || arg[0] == '<') {
+				redacted[i] = []byte(string(arg[0]) + "(redacted)")
+			}
+		}
+		return redacted
+	}
+	return args
+}
+
+func commandCmd(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received COMMAND command from %s", remoteAddr(conn))
+
+	if len(cmd.Args) == 1 {
+		writeCommandInfos(conn, sortedCommands())
+		return
+	}
+
+	switch strings.ToUpper(string(cmd.Args[1])) {
+	case "COUNT":
+		conn.WriteInt(len(commands))
+	case "INFO":
+		writeCommandInfos(conn, lookupCommands(cmd.Args[2:]))
+	case "DOCS":
+		cmds := sortedCommands()
+		if len(cmd.Args) > 2 {
+			cmds = lookupCommands(cmd.Args[2:])
+		}
+		writeCommandDocs(conn, cmds)
+	default:
+		conn.WriteError("ERR unknown subcommand '" + string(cmd.Args[1]) + "'. Try COMMAND COUNT, INFO or DOCS.")
+	}
+}
+
+// sortedCommands returns all commands sorted by name
+func sortedCommands() []*command {
+	cmds := make([]*command, 0, len(commands))
+	for _, c := range commands {
+		cmds = append(cmds, c)
+	}
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].name < cmds[j].name
+	})
+	return cmds
+}
+
+// lookupCommands returns the commands for given names
+// unsupported names result in a nil entry
+func lookupCommands(names [][]byte) []*command {
+	cmds := make([]*command, 0, len(names))
+	for _, name := range names {
+		cmds = append(cmds, commands[strings.ToLower(string(name))])
+	}
+	return cmds
+}
+
+// writeCommandInfos writes commands in the COMMAND INFO reply format
+func writeCommandInfos(conn redcon.Conn, cmds []*command) {
+	conn.WriteArray(len(cmds))
+	for _, c := range cmds {
+		if c == nil {
+			conn.WriteNull()
+			continue
+		}
+		conn.WriteArray(7)
+		conn.WriteBulkString(c.name)
+		conn.WriteInt(c.arity)
+		conn.WriteArray(len(c.flags))
+		for _, flag := range c.flags {
+			conn.WriteString(flag)
+		}
+		conn.WriteInt(c.firstKey)
+		conn.WriteInt(c.lastKey)
+		conn.WriteInt(c.keyStep)
+		conn.WriteArray(len(c.categories))
+		for _, category := range c.categories {
+			conn.WriteString(category)
+		}
+	}
+}
+
+// writeCommandDocs writes commands in the COMMAND DOCS reply format
+// unsupported commands are left out
+func writeCommandDocs(conn redcon.Conn, cmds []*command) {
+	var found []*command
+	for _, c := range cmds {
+		if c != nil {
+			found = append(found, c)
+		}
+	}
+
+	conn.WriteArray(len(found) * 2)
+	for _, c := range found {
+		conn.WriteBulkString(c.name)
+		conn.WriteArray(6)
+		conn.WriteBulkString("summary")
+		conn.WriteBulkString(c.summary)
+		conn.WriteBulkString("since")
+		conn.WriteBulkString(c.since)
+		conn.WriteBulkString("group")
+		conn.WriteBulkString(c.group)
+	}
+}
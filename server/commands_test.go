@@ -0,0 +1,197 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/server/jwt"
+)
+
+func TestValidArgCount(t *testing.T) {
+	assert := assert.New(t)
+
+	exact := &command{arity: 2}
+	assert.False(exact.validArgCount(1))
+	assert.True(exact.validArgCount(2))
+	assert.False(exact.validArgCount(3))
+
+	minimum := &command{arity: -2}
+	assert.False(minimum.validArgCount(1))
+	assert.True(minimum.validArgCount(2))
+	assert.True(minimum.validArgCount(10))
+}
+
+func TestDispatch(t *testing.T) {
+	conn := new(stubConn)
+
+	// commands are case insensitive
+	name := dispatch(conn, redcon.Command{Args: [][]byte{[]byte("PiNg")}})
+	assert.Equal(t, "ping", name)
+	assert.Equal(t, "PONG", conn.s)
+
+	name = dispatch(conn, redcon.Command{Args: [][]byte{[]byte("PING"), []byte("hello")}})
+	assert.Equal(t, "ping", name)
+	assert.Equal(t, "hello", conn.s)
+
+	name = dispatch(conn, redcon.Command{Args: [][]byte{[]byte("FOO")}})
+	assert.Equal(t, "unknown", name)
+	assert.Equal(t, "ERR unknown command 'FOO'", conn.s)
+
+	// authentication doesn't depend on the case of the command
+	permissionValidator = stubAuthValidator
+	name = dispatch(conn, redcon.Command{Args: [][]byte{[]byte("set"), []byte("key"), []byte("value")}})
+	assert.Equal(t, "set", name)
+	assert.Equal(t, unAuthMsg, conn.s)
+}
+
+func TestRequiredScopes(t *testing.T) {
+	assert := assert.New(t)
+	defer func(policy map[string]string) {
+		zConfig().AuthPolicy = policy
+	}(zConfig().AuthPolicy)
+
+	zConfig().AuthPolicy = map[string]string{
+		"@read":      ".read",
+		"@write":     ".write",
+		"@dangerous": ".dangerous",
+		"exists":     ".exists",
+	}
+
+	// category
+	assert.Equal(jwt.ReadScopes("org", "ns"), commands["get"].requiredScopes()("org", "ns"))
+	assert.Equal(jwt.WriteScopes("org", "ns"), commands["set"].requiredScopes()("org", "ns"))
+	// command entry takes precedence over the categories
+	assert.Equal([]string{"org.ns", "org.ns.exists"}, commands["exists"].requiredScopes()("org", "ns"))
+	// first category found in the policy
+	assert.Equal([]string{"org.ns", "org.ns.dangerous"}, commands["monitor"].requiredScopes()("org", "ns"))
+
+	// no entry only allows admins
+	delete(zConfig().AuthPolicy, "@dangerous")
+	assert.Equal(jwt.AdminScopes("org", "ns"), commands["monitor"].requiredScopes()("org", "ns"))
+}
+
+func TestAuthorizedAll(t *testing.T) {
+	assert := assert.New(t)
+	defer func(authCommands map[string]struct{}) {
+		zConfig().AuthCommands = authCommands
+		zConfig().AuthAll = false
+	}(zConfig().AuthCommands)
+	var scopes []string
+	permissionValidator = func(jwtStr, organization, namespace string, getExpectedScopes jwt.GetScopes) error {
+		scopes = getExpectedScopes(organization, namespace)
+		return nil
+	}
+	zConfig().JWTOrganization = "org"
+	zConfig().JWTNamespace = "ns"
+	zConfig().AuthCommands = make(map[string]struct{})
+	conn := new(stubConn)
+	getClient(conn).jwt = "aJWT"
+
+	// nothing requires auth
+	assert.True(authorized(conn, commands["exists"], redcon.Command{}))
+	assert.Nil(scopes)
+
+	// all commands require auth, except the ones that never do
+	zConfig().AuthAll = true
+	assert.True(authorized(conn, commands["ping"], redcon.Command{}))
+	assert.Nil(scopes)
+	assert.True(authorized(conn, commands["exists"], redcon.Command{}))
+	assert.Equal(jwt.ReadScopes("org", "ns"), scopes)
+
+	zConfig().JWTOrganization = ""
+	zConfig().JWTNamespace = ""
+}
+
+func TestCommandKeys(t *testing.T) {
+	assert := assert.New(t)
+	args := func(strs ...string) [][]byte {
+		var result [][]byte
+		for _, s := range strs {
+			result = append(result, []byte(s))
+		}
+		return result
+	}
+
+	assert.Equal(args("key"), commands["set"].keys(args("SET", "key", "value")))
+	assert.Equal(args("a", "b"), commands["exists"].keys(args("EXISTS", "a", "b")))
+	assert.Empty(commands["ping"].keys(args("PING", "hello")))
+}
+
+func TestRedactArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	args := [][]byte{[]byte("auth"), []byte("user"), []byte("password")}
+	assert.Equal([][]byte{[]byte("auth"), []byte("(redacted)")}, redactArgs(args))
+
+	args = [][]byte{[]byte("ACL"), []byte("setuser"), []byte("alice"), []byte("on"), []byte(">secret"), []byte("<old")}
+	assert.Equal([][]byte{
+		[]byte("ACL"), []byte("setuser"), []byte("alice"), []byte("on"), []byte(">(redacted)"), []byte("<(redacted)"),
+	}, redactArgs(args))
+	assert.Equal([]byte(">secret"), args[4], "original arguments should be untouched")
+
+	args = [][]byte{[]byte("GET"), []byte(">key")}
+	assert.Equal(args, redactArgs(args))
+}
+
+func TestCommandCmd(t *testing.T) {
+	assert := assert.New(t)
+	conn := new(recordConn)
+
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("COMMAND"), []byte("COUNT")}})
+	assert.Equal([]string{strconv.Itoa(len(commands))}, conn.replies)
+
+	conn.replies = nil
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("COMMAND"), []byte("INFO"), []byte("get"), []byte("foo")}})
+	assert.Equal([]string{
+		"*2",
+		"*7", "get", "2", "*2", "readonly", "fast", "1", "1", "1", "*3", "@read", "@string", "@fast",
+		"(nil)",
+	}, conn.replies)
+
+	conn.replies = nil
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("COMMAND"), []byte("INFO"), []byte("EXISTS")}})
+	assert.Equal([]string{
+		"*1",
+		"*7", "exists", "-2", "*2", "readonly", "fast", "1", "-1", "1", "*3", "@read", "@keyspace", "@fast",
+	}, conn.replies)
+
+	conn.replies = nil
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("COMMAND"), []byte("DOCS"), []byte("set"), []byte("foo")}})
+	assert.Equal([]string{
+		"*2",
+		"set", "*6", "summary", commands["set"].summary, "since", "1.0.0", "group", "string",
+	}, conn.replies)
+
+	// all commands, sorted by name
+	conn.replies = nil
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("COMMAND")}})
+	if assert.NotEmpty(conn.replies) {
+		assert.Equal("*"+strconv.Itoa(len(commands)), conn.replies[0])
+		assert.Equal("acl", conn.replies[2])
+	}
+
+	conn.replies = nil
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("COMMAND"), []byte("FOO")}})
+	assert.Equal([]string{"ERR unknown subcommand 'FOO'. Try COMMAND COUNT, INFO or DOCS."}, conn.replies)
+}
+
+// recordConn records all replies written to the connection
+// arrays are recorded as "*<count>" and null replies as "(nil)"
+type recordConn struct {
+	stubConn
+	replies []string
+}
+
+func (c *recordConn) WriteString(str string)      { c.replies = append(c.replies, str) }
+func (c *recordConn) WriteBulk(bulk []byte)       { c.replies = append(c.replies, string(bulk)) }
+func (c *recordConn) WriteBulkString(bulk string) { c.replies = append(c.replies, bulk) }
+func (c *recordConn) WriteInt(num int)            { c.replies = append(c.replies, strconv.Itoa(num)) }
+func (c *recordConn) WriteInt64(num int64) {
+	c.replies = append(c.replies, strconv.FormatInt(num, 10))
+}
+func (c *recordConn) WriteError(msg string) { c.replies = append(c.replies, msg) }
+func (c *recordConn) WriteArray(count int)  { c.replies = append(c.replies, "*"+strconv.Itoa(count)) }
+func (c *recordConn) WriteNull()            { c.replies = append(c.replies, "(nil)") }
+func (c *recordConn) WriteRaw(data []byte)  { c.replies = append(c.replies, string(data)) }
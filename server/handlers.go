@@ -1,102 +1,185 @@
 package server
 
 import (
+	"strconv"
+	"strings"
+
 	log "github.com/Sirupsen/logrus"
 	"github.com/tidwall/redcon"
 	"github.com/zero-os/zedis/server/jwt"
+	"github.com/zero-os/zedis/stor"
 )
 
 var (
 	permissionValidator = jwt.ValidatePermission
 	unAuthMsg           = "ERR no authentication token found for this connection"
+	certMissingScopeMsg = "ERR client certificate does not grant a scope Zedis requires"
 )
 
-func ping(conn redcon.Conn) {
-	log.Debugf("received PING command from %s", conn.RemoteAddr())
+// authorized checks if a connection is allowed to execute a command
+// according to the rules of its ACL user, or else the auth commands and the auth policy
+// an error is written to the connection when it isn't
+func authorized(conn redcon.Conn, c *command, cmd redcon.Command) bool {
+	// the rules of an ACL user apply to all commands but the connection commands, whatever the auth commands,
+	// and to SELECT, so users can be limited to databases (e.g.: +select|1)
+	if user := getClient(conn).user; user != "" && (!c.noAuth || c.name == "select") {
+		return userAuthorized(conn, user, c, cmd)
+	}
+	if c.noAuth {
+		return true
+	}
+
+	// check if command needs authentication
+	authCommands, authAll := listenerAuthCommands(getClient(conn).listener)
+	_, authorize := authCommands[strings.ToUpper(c.name)]
+	if !authorize && !authAll && !c.alwaysAuth {
+		return true
+	}
+	return authenticated(conn, c)
+}
+
+// authenticated checks if a connection has a JWT, or else a client certificate, with the scopes a command requires
+// an error is written to the connection when it hasn't
+func authenticated(conn redcon.Conn, cmd *command) bool {
+	c := getClient(conn)
+	organization, namespace := c.commandScope(cmd)
+	getExpectedScopes := cmd.requiredScopes()
+	if c.jwt == "" {
+		// connections with a verified client certificate are pre-authenticated
+		if scopes := c.certificateScopes(conn); scopes != nil {
+			if !jwt.HasScopes(scopes, organization, namespace, getExpectedScopes) {
+				conn.WriteError(certMissingScopeMsg)
+				return false
+			}
+			return true
+		}
+		conn.WriteError(unAuthMsg)
+		return false
+	}
+	err := c.validateJWT(c.jwt, organization, namespace, getExpectedScopes)
+	if err != nil {
+		conn.WriteError("ERR JWT invalid: " + err.Error())
+		return false
+	}
+
+	return true
+}
+
+func ping(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received PING command from %s", remoteAddr(conn))
+	if len(cmd.Args) > 1 {
+		conn.WriteBulk(cmd.Args[1])
+		return
+	}
 	conn.WriteString("PONG")
 }
 
-func quit(conn redcon.Conn) {
-	log.Debugf("received QUIT command from %s", conn.RemoteAddr())
+func quit(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received QUIT command from %s", remoteAddr(conn))
 	conn.WriteString("OK")
 	conn.Close()
 }
 
 func auth(conn redcon.Conn, cmd redcon.Command) {
-	log.Debugf("received AUTH command from %s", conn.RemoteAddr())
-	if len(cmd.Args) != 2 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-		return
+	log.Debugf("received AUTH command from %s", remoteAddr(conn))
+
+	switch len(cmd.Args) {
+	case 2:
+		authJWT(conn, string(cmd.Args[1]))
+	case 3:
+		authUser(conn, string(cmd.Args[1]), string(cmd.Args[2]))
+	default:
+		wrongArgCount(conn, cmd)
 	}
+}
 
-	jwtStr := string(cmd.Args[1])
+// authJWT authenticates a connection with a JWT
+func authJWT(conn redcon.Conn, jwtStr string) {
+	c := getClient(conn)
+	tenant, err := c.tenantOf(jwtStr)
+	if err != nil {
+		conn.WriteError("ERR invalid JWT: " + err.Error())
+		return
+	}
+	if tenant != "" {
+		if c.db != 0 {
+			conn.WriteError("ERR tenants can only use DB index 0")
+			return
+		}
+		_, err = tenantStor(tenant)
+		if err != nil {
+			conn.WriteError("ERR " + err.Error())
+			return
+		}
+	}
 
-	err := permissionValidator(jwtStr, zConfig.JWTOrganization, zConfig.JWTNamespace, nil)
+	// the previous tenant is kept when the JWT is invalid
+	previous := c.tenant
+	c.tenant = tenant
+	organization, namespace := c.scope()
+	err = c.validateJWT(jwtStr, organization, namespace, nil)
 	if err != nil {
+		c.tenant = previous
 		conn.WriteError("ERR invalid JWT: " + err.Error())
 		return
 	}
 
-	connsJWTLock.Lock()
-	connsJWT[conn] = jwtStr
-	connsJWTLock.Unlock()
+	c.setJWT(jwtStr)
+	c.jwtSubject, _ = jwt.Subject(jwtStr)
+	c.user = ""
 
 	conn.WriteString("OK")
 }
 
-func set(conn redcon.Conn, cmd redcon.Command) {
-	log.Debugf("received SET command from %s", conn.RemoteAddr())
-	if len(cmd.Args) != 3 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+// authUser authenticates a connection as an ACL user
+func authUser(conn redcon.Conn, username, password string) {
+	if !authenticateUser(username, password) {
+		conn.WriteError("WRONGPASS invalid username-password pair or user is disabled.")
 		return
 	}
 
-	// check if command needs authentication
-	_, authorize := zConfig.AuthCommands[string(cmd.Args[0])]
-	if authorize {
-		connsJWTLock.Lock()
-		jwtStr, ok := connsJWT[conn]
-		connsJWTLock.Unlock()
-		if !ok {
-			conn.WriteError(unAuthMsg)
-			return
-		}
-		err := permissionValidator(jwtStr, zConfig.JWTOrganization, zConfig.JWTNamespace, jwt.WriteScopes)
-		if err != nil {
-			conn.WriteError("ERR JWT invalid: " + err.Error())
-			return
-		}
-	}
-	storClient.Write(cmd.Args[1], cmd.Args[2])
+	c := getClient(conn)
+	c.user = username
+	c.setJWT("")
+	c.jwtSubject = ""
+	c.tenant = ""
 
 	conn.WriteString("OK")
 }
 
-func get(conn redcon.Conn, cmd redcon.Command) {
-	log.Debugf("received GET command from %s", conn.RemoteAddr())
-	if len(cmd.Args) != 2 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+func selectCmd(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received SELECT command from %s", remoteAddr(conn))
+
+	db, err := strconv.Atoi(string(cmd.Args[1]))
+	if err != nil {
+		conn.WriteError("ERR invalid DB index")
+		return
+	}
+	c := getClient(conn)
+	if !zConfig().DatabaseExists(db) || (c.tenant != "" && db != 0) {
+		conn.WriteError("ERR DB index is out of range")
 		return
 	}
 
-	// check if command needs authentication
-	_, authorize := zConfig.AuthCommands[string(cmd.Args[0])]
-	if authorize {
-		connsJWTLock.Lock()
-		jwtStr, ok := connsJWT[conn]
-		connsJWTLock.Unlock()
-		if !ok {
-			conn.WriteError(unAuthMsg)
-			return
-		}
-		err := permissionValidator(jwtStr, zConfig.JWTOrganization, zConfig.JWTNamespace, jwt.ReadScopes)
-		if err != nil {
-			conn.WriteError("ERR JWT invalid: " + err.Error())
-			return
-		}
+	c.db = db
+	conn.WriteString("OK")
+}
+
+func set(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received SET command from %s", remoteAddr(conn))
+	err := storFor(conn).Write(commandContext(conn), cmd.Args[1], cmd.Args[2])
+	if err != nil {
+		conn.WriteError("ERR writing to the stor: " + err.Error())
+		return
 	}
 
-	val, err := storClient.Read(cmd.Args[1])
+	conn.WriteString("OK")
+}
+
+func get(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received GET command from %s", remoteAddr(conn))
+
+	val, err := storFor(conn).Read(commandContext(conn), cmd.Args[1])
 
 	if err != nil {
 		conn.WriteError("ERR reading from the stor: " + err.Error())
@@ -107,32 +190,17 @@ func get(conn redcon.Conn, cmd redcon.Command) {
 }
 
 func exists(conn redcon.Conn, cmd redcon.Command) {
-	log.Debugf("received EXISTS command from %s", conn.RemoteAddr())
-	if len(cmd.Args) < 2 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-		return
-	}
-
-	// check if command needs authentication
-	_, authorize := zConfig.AuthCommands[string(cmd.Args[0])]
-	if authorize {
-		connsJWTLock.Lock()
-		jwtStr, ok := connsJWT[conn]
-		connsJWTLock.Unlock()
-		if !ok {
-			conn.WriteError(unAuthMsg)
-			return
-		}
-		err := permissionValidator(jwtStr, zConfig.JWTOrganization, zConfig.JWTNamespace, jwt.ReadScopes)
-		if err != nil {
-			conn.WriteError("ERR JWT invalid: " + err.Error())
-			return
-		}
-	}
+	log.Debugf("received EXISTS command from %s", remoteAddr(conn))
 
+	sc := storFor(conn)
+	ctx := commandContext(conn)
 	keysFound := 0
 	for _, key := range cmd.Args[1:] {
-		found, err := storClient.KeyExists(key)
+		found, err := sc.KeyExists(ctx, key)
+		if err == stor.ErrTimeout || err == stor.ErrBusy {
+			conn.WriteError("ERR checking the stor: " + err.Error())
+			return
+		}
 		if err != nil {
 			log.Errorf("checking if data exists in the store went wrong: %s", err)
 		}
@@ -144,7 +212,100 @@ func exists(conn redcon.Conn, cmd redcon.Command) {
 	conn.WriteInt(keysFound)
 }
 
+func slowlogCmd(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received SLOWLOG command from %s", remoteAddr(conn))
+
+	switch strings.ToUpper(string(cmd.Args[1])) {
+	case "GET":
+		count := defaultSlowlogGetCount
+		if len(cmd.Args) > 2 {
+			var err error
+			count, err = strconv.Atoi(string(cmd.Args[2]))
+			if err != nil {
+				conn.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+		}
+		writeSlowlogEntries(conn, slowLog.get(count))
+	case "LEN":
+		conn.WriteInt(slowLog.len())
+	case "RESET":
+		slowLog.reset()
+		conn.WriteString("OK")
+	default:
+		conn.WriteError("ERR unknown subcommand '" + string(cmd.Args[1]) + "'. Try SLOWLOG GET, LEN or RESET.")
+	}
+}
+
+func monitorCmd(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received MONITOR command from %s", remoteAddr(conn))
+
+	startMonitor(conn)
+}
+
+func aclCmd(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received ACL command from %s", remoteAddr(conn))
+
+	switch strings.ToUpper(string(cmd.Args[1])) {
+	case "SETUSER":
+		if len(cmd.Args) < 3 {
+			wrongArgCount(conn, cmd)
+			return
+		}
+		rules := make([]string, 0, len(cmd.Args)-3)
+		for _, arg := range cmd.Args[3:] {
+			rules = append(rules, string(arg))
+		}
+		err := setACLUser(string(cmd.Args[2]), rules)
+		if err != nil {
+			conn.WriteError("ERR " + err.Error())
+			return
+		}
+		conn.WriteString("OK")
+	case "DELUSER":
+		if len(cmd.Args) < 3 {
+			wrongArgCount(conn, cmd)
+			return
+		}
+		names := make([]string, 0, len(cmd.Args)-2)
+		for _, arg := range cmd.Args[2:] {
+			names = append(names, string(arg))
+		}
+		conn.WriteInt(deleteACLUsers(names))
+	case "LIST":
+		users := listACLUsers()
+		conn.WriteArray(len(users))
+		for _, user := range users {
+			conn.WriteBulkString(user)
+		}
+	case "WHOAMI":
+		user := getClient(conn).user
+		if user == "" {
+			user = "default"
+		}
+		conn.WriteBulkString(user)
+	case "LOAD", "SAVE":
+		if zConfig().ACLFile == "" {
+			conn.WriteError("ERR This Zedis instance is not configured to use an ACL file. Set acl_file in the config.")
+			return
+		}
+		var err error
+		if strings.ToUpper(string(cmd.Args[1])) == "LOAD" {
+			err = loadACLFile(zConfig().ACLFile)
+		} else {
+			err = saveACLFile(zConfig().ACLFile)
+		}
+		if err != nil {
+			conn.WriteError("ERR " + err.Error())
+			return
+		}
+		conn.WriteString("OK")
+	default:
+		conn.WriteError("ERR unknown subcommand '" + string(cmd.Args[1]) + "'. Try ACL SETUSER, DELUSER, LIST, WHOAMI, LOAD or SAVE.")
+	}
+}
+
 func unknown(conn redcon.Conn, cmd redcon.Command) {
-	log.Debugf("received unknown command %s from %s", string(cmd.Args[0]), conn.RemoteAddr())
+	log.Debugf("received unknown command %s from %s", string(cmd.Args[0]), remoteAddr(conn))
 	conn.WriteError("ERR unknown command '" + string(cmd.Args[0]) + "'")
 }
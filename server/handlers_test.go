@@ -1,11 +1,12 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"strconv"
-	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,27 +16,31 @@ import (
 )
 
 func init() {
-	connsJWT = make(map[redcon.Conn]string)
-	connsJWTLock = &sync.Mutex{}
-	zConfig = new(config.Zedis)
-	zConfig.AuthCommands = make(map[string]struct{})
+	setZConfig(new(config.Zedis))
+	zConfig().AuthCommands = make(map[string]struct{})
 
 	// manually set each command to require authentication
-	zConfig.AuthCommands["SET"] = struct{}{}
-	zConfig.AuthCommands["GET"] = struct{}{}
-	zConfig.AuthCommands["EXISTS"] = struct{}{}
+	zConfig().AuthCommands["SET"] = struct{}{}
+	zConfig().AuthCommands["GET"] = struct{}{}
+	zConfig().AuthCommands["EXISTS"] = struct{}{}
+	zConfig().AuthCommands["SLOWLOG"] = struct{}{}
+	zConfig().AuthPolicy = map[string]string{
+		"@read":  ".read",
+		"@write": ".write",
+		"@admin": ".admin",
+	}
 }
 
 func TestPing(t *testing.T) {
 	conn := new(stubConn)
-	ping(conn)
+	ping(conn, redcon.Command{Args: [][]byte{[]byte("PING")}})
 	assert.Equal(t, "PONG", conn.s)
 
 }
 
 func TestQuit(t *testing.T) {
 	conn := new(stubConn)
-	quit(conn)
+	quit(conn, redcon.Command{Args: [][]byte{[]byte("QUIT")}})
 	assert.Equal(t, "OK", conn.s)
 	assert.True(t, conn.closed)
 }
@@ -52,7 +57,7 @@ func TestAuth(t *testing.T) {
 		[]byte("jwtString"),
 	}
 
-	auth(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "OK", conn.s)
 
 	// in case permission would fail
@@ -62,7 +67,7 @@ func TestAuth(t *testing.T) {
 		[]byte("jwtString"),
 	}
 
-	auth(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "ERR invalid JWT: a stub error", conn.s)
 
 	// invalid command length
@@ -70,9 +75,10 @@ func TestAuth(t *testing.T) {
 		[]byte("AUTH"),
 		[]byte("hello"),
 		[]byte("world"),
+		[]byte("foo"),
 	}
 
-	auth(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "ERR wrong number of arguments for 'AUTH' command", conn.s)
 
 }
@@ -91,20 +97,20 @@ func TestSet(t *testing.T) {
 		[]byte("value"),
 	}
 
-	set(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, unAuthMsg, conn.s)
 
 	// valid args and jwt present
-	connsJWT[conn] = "aJWT"
+	getClient(conn).jwt = "aJWT"
 
-	set(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "OK", conn.s)
 	assert.Equal(t, []byte("value"), stubStorClient.stor["key"])
 
 	// invalid jwt
 	permissionValidator = stubAuthValidatorErr
 
-	set(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "ERR JWT invalid: a stub error", conn.s)
 
 	// invalid command length
@@ -114,14 +120,14 @@ func TestSet(t *testing.T) {
 		[]byte("key"),
 	}
 
-	set(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "ERR wrong number of arguments for 'SET' command", conn.s)
 }
 
 func TestGet(t *testing.T) {
 	permissionValidator = stubAuthValidator
 	storClient = newStubStorClient()
-	storClient.Write([]byte("hello"), []byte("world"))
+	storClient.Write(context.Background(), []byte("hello"), []byte("world"))
 	conn := new(stubConn)
 	var cmd redcon.Command
 
@@ -131,18 +137,18 @@ func TestGet(t *testing.T) {
 		[]byte("hello"),
 	}
 
-	get(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, unAuthMsg, conn.s)
 
 	// valid args, valid JWT
-	connsJWT[conn] = "aJWT"
-	get(conn, cmd)
+	getClient(conn).jwt = "aJWT"
+	dispatch(conn, cmd)
 	assert.Equal(t, "world", conn.s)
 
 	// invalid jwt
 	permissionValidator = stubAuthValidatorErr
 
-	get(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "ERR JWT invalid: a stub error", conn.s)
 
 	// invalid command length
@@ -153,16 +159,16 @@ func TestGet(t *testing.T) {
 		[]byte("world"),
 	}
 
-	get(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "ERR wrong number of arguments for 'GET' command", conn.s)
 }
 
 func TestExists(t *testing.T) {
 	permissionValidator = stubAuthValidator
 	storClient = newStubStorClient()
-	storClient.Write([]byte("hello"), []byte("world"))
-	storClient.Write([]byte("lorem"), []byte("ipsum"))
-	storClient.Write([]byte("foo"), []byte("bar"))
+	storClient.Write(context.Background(), []byte("hello"), []byte("world"))
+	storClient.Write(context.Background(), []byte("lorem"), []byte("ipsum"))
+	storClient.Write(context.Background(), []byte("foo"), []byte("bar"))
 	conn := new(stubConn)
 	var cmd redcon.Command
 
@@ -172,14 +178,14 @@ func TestExists(t *testing.T) {
 		[]byte("hello"),
 	}
 
-	exists(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, unAuthMsg, conn.s)
 
 	// invalid jwt
-	connsJWT[conn] = "aJWT"
+	getClient(conn).jwt = "aJWT"
 	permissionValidator = stubAuthValidatorErr
 
-	exists(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "ERR JWT invalid: a stub error", conn.s)
 
 	// invalid command length
@@ -188,7 +194,7 @@ func TestExists(t *testing.T) {
 		[]byte("EXISTS"),
 	}
 
-	exists(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "ERR wrong number of arguments for 'EXISTS' command", conn.s)
 
 	// valid args, valid JWT
@@ -196,7 +202,7 @@ func TestExists(t *testing.T) {
 		[]byte("EXISTS"),
 		[]byte("hello"),
 	}
-	exists(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "1", conn.s)
 
 	// check 2 present keys
@@ -206,7 +212,7 @@ func TestExists(t *testing.T) {
 		[]byte("hello"),
 		[]byte("lorem"),
 	}
-	exists(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "2", conn.s)
 
 	// check 3 present keys
@@ -216,7 +222,7 @@ func TestExists(t *testing.T) {
 		[]byte("lorem"),
 		[]byte("foo"),
 	}
-	exists(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "3", conn.s)
 
 	// check 2 presents keys and 1 non present
@@ -226,9 +232,138 @@ func TestExists(t *testing.T) {
 		[]byte("lorem"),
 		[]byte("not_a_key"),
 	}
-	exists(conn, cmd)
+	dispatch(conn, cmd)
 	assert.Equal(t, "2", conn.s)
 }
+func TestSelect(t *testing.T) {
+	defer func() {
+		zConfig().Databases = nil
+		zConfig().JWTNamespace = ""
+	}()
+	zConfig().JWTNamespace = "ns"
+	zConfig().Databases = []config.Database{{Index: 1, Namespace: "ns1"}}
+	db0 := newStubStorClient()
+	db1 := newStubStorClient()
+	storClient = db0
+	dbStorClients[1] = db1
+	var namespace string
+	permissionValidator = func(jwtStr, organization, ns string, getExpectedScopes jwt.GetScopes) error {
+		namespace = ns
+		return nil
+	}
+	conn := new(stubConn)
+	getClient(conn).jwt = "aJWT"
+	var cmd redcon.Command
+
+	// select a configured database
+	cmd.Args = [][]byte{
+		[]byte("SELECT"),
+		[]byte("1"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "OK", conn.s)
+
+	// data is written to the database's stor, authorized against its namespace
+	cmd.Args = [][]byte{
+		[]byte("SET"),
+		[]byte("key"),
+		[]byte("value"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "OK", conn.s)
+	assert.Equal(t, []byte("value"), db1.stor["key"])
+	assert.Empty(t, db0.stor)
+	assert.Equal(t, "ns1", namespace)
+
+	// back to database 0
+	cmd.Args = [][]byte{
+		[]byte("SELECT"),
+		[]byte("0"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "OK", conn.s)
+	cmd.Args = [][]byte{
+		[]byte("GET"),
+		[]byte("key"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "ERR reading from the stor: key was not found", conn.s)
+	assert.Equal(t, "ns", namespace)
+
+	// unknown database
+	cmd.Args = [][]byte{
+		[]byte("SELECT"),
+		[]byte("2"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "ERR DB index is out of range", conn.s)
+	assert.Equal(t, 0, getClient(conn).db)
+
+	cmd.Args = [][]byte{
+		[]byte("SELECT"),
+		[]byte("one"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "ERR invalid DB index", conn.s)
+}
+
+func TestServerCommandsNeedDatabase0Scope(t *testing.T) {
+	assert := assert.New(t)
+	defer func() {
+		zConfig().Databases = nil
+		zConfig().JWTOrganization = ""
+		zConfig().JWTNamespace = ""
+	}()
+	zConfig().JWTOrganization = "org"
+	zConfig().JWTNamespace = "ns"
+	zConfig().Databases = []config.Database{{Index: 1, Namespace: "ns1"}}
+	dbStorClients[1] = newStubStorClient()
+	permissionValidator = scopesValidator(map[string][]string{
+		"db1Admin": {"org.ns1"},
+		"admin":    {"org.ns"},
+	})
+
+	conn := new(stubConn)
+	defer removeClient(conn)
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("SELECT"), []byte("1")}})
+	getClient(conn).jwt = "db1Admin"
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("SET"), []byte("key"), []byte("value")}})
+	assert.Equal("OK", conn.s, "admin of the selected database")
+
+	for _, args := range []string{"CONFIG GET port", "ACL LIST", "REVOKE LIST", "SLOWLOG LEN", "MONITOR"} {
+		conn.s = ""
+		dispatch(conn, redcon.Command{Args: bytes.Fields([]byte(args))})
+		assert.Equal("ERR JWT invalid: "+jwt.ErrMissingScope.Error(), conn.s, args)
+	}
+
+	getClient(conn).jwt = "admin"
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("SLOWLOG"), []byte("LEN")}})
+	assert.NotContains(conn.s, "ERR", "admin of database 0")
+}
+
+func TestAdminCommandsAlwaysNeedAuth(t *testing.T) {
+	assert := assert.New(t)
+	permissionValidator = stubAuthValidator
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.AuthCommands = map[string]struct{}{}
+	setZConfig(&cfg)
+
+	conn := new(stubConn)
+	defer removeClient(conn)
+	for _, args := range []string{"SLOWLOG GET", "SLOWLOG LEN", "SLOWLOG RESET"} {
+		conn.s = ""
+		dispatch(conn, redcon.Command{Args: bytes.Fields([]byte(args))})
+		assert.Equal(unAuthMsg, conn.s, args)
+	}
+
+	for name, c := range commands {
+		if contains(c.categories, "@admin") {
+			assert.True(c.alwaysAuth, name)
+		}
+	}
+}
+
 func TestUnknown(t *testing.T) {
 	var cmd redcon.Command
 	cmd.Args = [][]byte{
@@ -260,10 +395,12 @@ func (c *stubConn) WriteBulk(bulk []byte)       { c.s = string(bulk) }
 func (c *stubConn) WriteBulkString(bulk string) { c.s = bulk }
 func (c *stubConn) WriteInt(num int)            { c.s = strconv.Itoa(num) }
 func (c *stubConn) WriteInt64(num int64)        { c.s = strconv.FormatInt(num, 10) }
+func (c *stubConn) WriteUint64(num uint64)      { c.s = strconv.FormatUint(num, 10) }
 func (c *stubConn) WriteError(msg string)       { c.s = msg }
 func (c *stubConn) WriteArray(count int)        { c.s = strconv.Itoa(count) }
 func (c *stubConn) WriteNull()                  { c.s = "" }
 func (c *stubConn) WriteRaw(data []byte)        { c.s = string(data) }
+func (c *stubConn) WriteAny(v interface{})      { c.s = fmt.Sprint(v) }
 func (c *stubConn) RemoteAddr() string          { return "127.0.0.1" }
 func (c *stubConn) ReadPipeline() []redcon.Command {
 	cmds := c.cmds
@@ -287,18 +424,18 @@ type stubStorClient struct {
 }
 
 func (c *stubStorClient) Close() { c.closed = true }
-func (c *stubStorClient) Read(key []byte) ([]byte, error) {
+func (c *stubStorClient) Read(ctx context.Context, key []byte) ([]byte, error) {
 	val, ok := c.stor[string(key)]
 	if !ok {
 		return nil, errors.New("key was not found")
 	}
 	return val, nil
 }
-func (c *stubStorClient) Write(key []byte, value []byte) error {
+func (c *stubStorClient) Write(ctx context.Context, key []byte, value []byte) error {
 	c.stor[string(key)] = value
 	return nil
 }
-func (c *stubStorClient) KeyExists(key []byte) (bool, error) {
+func (c *stubStorClient) KeyExists(ctx context.Context, key []byte) (bool, error) {
 	_, ok := c.stor[string(key)]
 	return ok, nil
 }
@@ -308,6 +445,16 @@ func stubAuthValidator(jwtStr, organization, namespace string, getExpectedScopes
 	return nil
 }
 
+// scopesValidator returns a validator checking the scopes of stub JWTs
+func scopesValidator(scopes map[string][]string) func(string, string, string, jwt.GetScopes) error {
+	return func(jwtStr, organization, namespace string, getExpectedScopes jwt.GetScopes) error {
+		if !jwt.HasScopes(scopes[jwtStr], organization, namespace, getExpectedScopes) {
+			return jwt.ErrMissingScope
+		}
+		return nil
+	}
+}
+
 // stub validator that returns "a stub error" error
 func stubAuthValidatorErr(jwtStr, organization, namespace string, getExpectedScopes jwt.GetScopes) error {
 	return errors.New("a stub error")
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+)
+
+// sections replied by INFO, in order
+var infoSections = []struct {
+	name  string
+	title string
+	write func(b *bytes.Buffer)
+}{
+	{"clients", "Clients", writeClientsInfo},
+	{"stats", "Stats", writeStatsInfo},
+	{"ratelimits", "Ratelimits", writeRateLimitsInfo},
+}
+
+func infoCmd(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received INFO command from %s", remoteAddr(conn))
+
+	requested := make(map[string]bool)
+	for _, arg := range cmd.Args[1:] {
+		requested[strings.ToLower(string(arg))] = true
+	}
+	all := len(requested) == 0 || requested["all"] || requested["default"] || requested["everything"]
+
+	var b bytes.Buffer
+	for _, section := range infoSections {
+		if !all && !requested[section.name] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + section.title + "\r\n")
+		section.write(&b)
+	}
+	conn.WriteBulk(b.Bytes())
+}
+
+func writeClientsInfo(b *bytes.Buffer) {
+	zc := zConfig()
+	fmt.Fprintf(b, "connected_clients:%d\r\n", connectedClients())
+	fmt.Fprintf(b, "maxclients:%d\r\n", zc.MaxClients)
+	fmt.Fprintf(b, "maxclients_per_ip:%d\r\n", zc.MaxClientsPerIP)
+}
+
+func writeStatsInfo(b *bytes.Buffer) {
+	fmt.Fprintf(b, "total_commands_processed:%.0f\r\n", cmdTotal.total())
+	fmt.Fprintf(b, "rejected_connections:%.0f\r\n", rejectedConns.total())
+	fmt.Fprintf(b, "rejected_connections_per_ip:%.0f\r\n", rejectedConns.value("maxclients_per_ip"))
+	fmt.Fprintf(b, "rate_limited_commands:%.0f\r\n", rateLimited.total())
+}
+
+// writeRateLimitsInfo writes a line per configured rate limit, e.g.:
+// ratelimit_write:rate=10,burst=20,limited=3
+func writeRateLimitsInfo(b *bytes.Buffer) {
+	limits := zConfig().RateLimits
+	categories := make([]string, 0, len(limits))
+	for category := range limits {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		limit := limits[category]
+		fmt.Fprintf(b, "ratelimit_%s:rate=%g,burst=%d,limited=%.0f\r\n",
+			strings.TrimPrefix(category, "@"), limit.Rate, limit.Burst, rateLimited.value(category))
+	}
+}
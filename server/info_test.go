@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/config"
+)
+
+func TestInfoCmd(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.MaxClients = 100
+	cfg.MaxClientsPerIP = 10
+	cfg.RateLimits = map[string]config.RateLimit{
+		"@write": {Rate: 10, Burst: 20},
+		"@read":  {Rate: 0.5, Burst: 1},
+	}
+	setZConfig(&cfg)
+
+	conn := new(stubConn)
+	infoCmd(conn, redcon.Command{Args: [][]byte{[]byte("INFO")}})
+	assert.Contains(conn.s, "# Clients\r\nconnected_clients:")
+	assert.Contains(conn.s, "maxclients:100\r\nmaxclients_per_ip:10\r\n")
+	assert.Contains(conn.s, "\r\n# Stats\r\n")
+	assert.Contains(conn.s, "rate_limited_commands:")
+	assert.Contains(conn.s, "# Ratelimits\r\nratelimit_read:rate=0.5,burst=1,limited=")
+	assert.Contains(conn.s, "ratelimit_write:rate=10,burst=20,limited=")
+
+	infoCmd(conn, redcon.Command{Args: [][]byte{[]byte("INFO"), []byte("RATELIMITS")}})
+	assert.NotContains(conn.s, "# Clients")
+	assert.Contains(conn.s, "# Ratelimits")
+
+	infoCmd(conn, redcon.Command{Args: [][]byte{[]byte("INFO"), []byte("keyspace")}})
+	assert.Equal("", conn.s, "unknown sections are empty")
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/zero-os/zedis/config"
+	"github.com/zero-os/zedis/server/jwt"
+)
+
+// configureJWTIssuers sets the trusted JWT issuers of the config
+// the default itsyou.online issuer is used when none are configured
+func configureJWTIssuers(cfgs []config.JWTIssuer) error {
+	if len(cfgs) == 0 {
+		return jwt.SetDefaultIssuer()
+	}
+	issuers, err := jwtIssuers(cfgs)
+	if err != nil {
+		return err
+	}
+	return jwt.SetIssuers(issuers)
+}
+
+// jwtIssuers loads the keys of the configured issuers
+func jwtIssuers(cfgs []config.JWTIssuer) ([]jwt.Issuer, error) {
+	issuers := make([]jwt.Issuer, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		issuer, err := jwtIssuer(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("jwt issuer %d (%s): %v", i, cfg.Issuer, err)
+		}
+		issuers = append(issuers, issuer)
+	}
+	return issuers, nil
+}
+
+// jwtIssuer loads the keys of an issuer
+func jwtIssuer(cfg config.JWTIssuer) (jwt.Issuer, error) {
+	issuer := jwt.Issuer{
+		Issuer:     cfg.Issuer,
+		Audience:   cfg.Audience,
+		Algorithms: cfg.Algorithms,
+	}
+
+	pems := make([][]byte, 0, len(cfg.PublicKeys)+len(cfg.PublicKeyFiles))
+	for _, key := range cfg.PublicKeys {
+		pems = append(pems, []byte(key))
+	}
+	for _, path := range cfg.PublicKeyFiles {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return issuer, err
+		}
+		pems = append(pems, data)
+	}
+	for _, data := range pems {
+		keys, err := jwt.ParsePublicKeys(data)
+		if err != nil {
+			return issuer, err
+		}
+		for _, key := range keys {
+			issuer.Keys = append(issuer.Keys, jwt.Key{Key: key})
+		}
+	}
+
+	if cfg.JWKSFile != "" {
+		data, err := ioutil.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return issuer, err
+		}
+		keys, err := jwt.ParseJWKS(data)
+		if err != nil {
+			return issuer, fmt.Errorf("invalid JWKS file %s: %v", cfg.JWKSFile, err)
+		}
+		issuer.Keys = append(issuer.Keys, keys...)
+	}
+
+	return issuer, nil
+}
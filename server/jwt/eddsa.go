@@ -0,0 +1,50 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"errors"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethodEdDSA implements the EdDSA (Ed25519) signing method,
+// which isn't provided by jwt-go
+var SigningMethodEdDSA = new(signingMethodEdDSA)
+
+func init() {
+	jwtgo.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwtgo.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+type signingMethodEdDSA struct{}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+// Verify verifies the signature with an ed25519.PublicKey
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok || len(publicKey) != ed25519.PublicKeySize {
+		return jwtgo.ErrInvalidKeyType
+	}
+
+	sig, err := jwtgo.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return errors.New("ed25519: verification error")
+	}
+	return nil
+}
+
+// Sign signs with an ed25519.PrivateKey
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok || len(privateKey) != ed25519.PrivateKeySize {
+		return "", jwtgo.ErrInvalidKeyType
+	}
+	return jwtgo.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
@@ -0,0 +1,294 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+// SupportedAlgorithms are the signing algorithms an issuer can be configured with
+var SupportedAlgorithms = []string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512", "EdDSA"}
+
+var (
+	issuers     []Issuer
+	issuersLock = new(sync.RWMutex)
+
+	// ErrUntrustedJWT is returned when a JWT is not signed by one of the trusted issuers
+	ErrUntrustedJWT = errors.New("JWT is not signed by a trusted issuer")
+)
+
+// Issuer defines a trusted JWT issuer
+type Issuer struct {
+	// expected iss claim, not checked when empty
+	Issuer string
+	// expected aud claim, not checked when empty
+	Audience string
+	// allowed signing algorithms, all supported algorithms when empty
+	Algorithms []string
+	// keys verifying the signature of the JWTs
+	Keys []Key
+}
+
+// Key is a public key verifying JWT signatures
+type Key struct {
+	// key ID, matched with the kid header of a JWT when both are set
+	ID  string
+	Key crypto.PublicKey
+}
+
+// SetIssuers sets the trusted JWT issuers
+// cached JWTs are dropped, they might not be trusted anymore
+func SetIssuers(trusted []Issuer) error {
+	for _, issuer := range trusted {
+		if len(issuer.Keys) == 0 {
+			return fmt.Errorf("issuer %q has no keys", issuer.Issuer)
+		}
+		for _, alg := range issuer.Algorithms {
+			if !supportedAlgorithm(alg) {
+				return fmt.Errorf("issuer %q has unsupported algorithm %s", issuer.Issuer, alg)
+			}
+		}
+	}
+
+	issuersLock.Lock()
+	issuers = trusted
+	issuersLock.Unlock()
+	purgeCache()
+	return nil
+}
+
+// ParsePublicKeys parses the PEM encoded public keys (EC, RSA or Ed25519) in data
+func ParsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		default:
+			err = fmt.Errorf("unsupported PEM block type %s", block.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+	return keys, nil
+}
+
+// jwk is a JSON Web Key as found in a JWKS
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// ParseJWKS parses the signature keys of a JSON Web Key Set
+func ParseJWKS(data []byte) ([]Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []Key
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", k.Kid, err)
+		}
+		keys = append(keys, Key{ID: k.Kid, Key: key})
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signature keys found in JWKS")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := jwtgo.DecodeSegment(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := jwtgo.DecodeSegment(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("missing key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func supportedAlgorithm(alg string) bool {
+	for _, supported := range SupportedAlgorithms {
+		if alg == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns true if the issuer allows a signing algorithm
+func (i *Issuer) allows(alg string) bool {
+	if len(i.Algorithms) == 0 {
+		return supportedAlgorithm(alg)
+	}
+	for _, allowed := range i.Algorithms {
+		if alg == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// validClaims checks the iss and aud claims expected by the issuer
+func (i *Issuer) validClaims(claims jwtgo.MapClaims) bool {
+	if i.Issuer != "" {
+		iss, _ := claims["iss"].(string)
+		if iss != i.Issuer {
+			return false
+		}
+	}
+	if i.Audience == "" {
+		return true
+	}
+
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == i.Audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == i.Audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseToken parses a JWT signed by one of the trusted issuers
+func parseToken(jwtStr string) (jwtgo.MapClaims, error) {
+	token, err := jwtgo.Parse(jwtStr, func(token *jwtgo.Token) (interface{}, error) {
+		claims, ok := token.Claims.(jwtgo.MapClaims)
+		if !ok {
+			return nil, ErrUntrustedJWT
+		}
+		kid, _ := token.Header["kid"].(string)
+		parts := strings.Split(jwtStr, ".")
+
+		issuersLock.RLock()
+		defer issuersLock.RUnlock()
+		for i := range issuers {
+			issuer := &issuers[i]
+			if !issuer.allows(token.Method.Alg()) || !issuer.validClaims(claims) {
+				continue
+			}
+			for _, key := range issuer.Keys {
+				if kid != "" && key.ID != "" && kid != key.ID {
+					continue
+				}
+				if token.Method.Verify(parts[0]+"."+parts[1], parts[2], key.Key) == nil {
+					return key.Key, nil
+				}
+			}
+		}
+		return nil, ErrUntrustedJWT
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwtgo.MapClaims)
+	if !(ok && token.Valid) {
+		return nil, fmt.Errorf("invalid JWT token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,178 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssuers(t *testing.T) {
+	assert := assert.New(t)
+	defer resetIssuers(t)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(err) {
+		return
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(err) {
+		return
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if !assert.NoError(err) {
+		return
+	}
+
+	ecKeys, err := ParsePublicKeys(pemPublicKey(t, &ecKey.PublicKey))
+	if !assert.NoError(err) {
+		return
+	}
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "OKP", "crv": "Ed25519", "kid": "ed1", "x": %q},
+		{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": %q, "e": "AQAB"},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"}
+	]}`, jwtgo.EncodeSegment(edPub), jwtgo.EncodeSegment(rsaKey.N.Bytes()))
+	jwksKeys, err := ParseJWKS([]byte(jwks))
+	if !assert.NoError(err) || !assert.Len(jwksKeys, 2, "encryption keys should be skipped") {
+		return
+	}
+
+	err = SetIssuers([]Issuer{
+		{
+			Issuer:     "idp",
+			Audience:   "zedis",
+			Algorithms: []string{"ES256"},
+			Keys:       []Key{{Key: ecKeys[0]}},
+		},
+		{
+			Issuer: "jwks",
+			Keys:   jwksKeys,
+		},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+
+	claims := func(iss string, aud interface{}) jwtgo.MapClaims {
+		return jwtgo.MapClaims{
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iss":   iss,
+			"aud":   aud,
+			"scope": "org.ns org.ns.read",
+		}
+	}
+
+	// PEM key with iss and aud checks
+	token := signToken(t, jwtgo.SigningMethodES256, ecKey, "", claims("idp", "zedis"))
+	scopes, err := Scopes(token)
+	assert.NoError(err)
+	assert.Equal([]string{"org.ns", "org.ns.read"}, scopes, "space separated scopes should be split")
+	token = signToken(t, jwtgo.SigningMethodES256, ecKey, "", claims("idp", []interface{}{"other", "zedis"}))
+	assert.NoError(ValidatePermission(token, "org", "ns", ReadScopes))
+
+	token = signToken(t, jwtgo.SigningMethodES256, ecKey, "", claims("idp", "other"))
+	_, err = Scopes(token)
+	assert.Error(err, "wrong audience")
+	token = signToken(t, jwtgo.SigningMethodES256, ecKey, "", claims("jwks", "zedis"))
+	_, err = Scopes(token)
+	assert.Error(err, "wrong issuer for the key")
+	token = signToken(t, jwtgo.SigningMethodES384, mustECKey(t, elliptic.P384()), "", claims("idp", "zedis"))
+	_, err = Scopes(token)
+	assert.Error(err, "algorithm not allowed")
+
+	// JWKS keys, selected by kid
+	token = signToken(t, SigningMethodEdDSA, edKey, "ed1", claims("jwks", nil))
+	_, err = Scopes(token)
+	assert.NoError(err)
+	token = signToken(t, jwtgo.SigningMethodRS256, rsaKey, "rsa1", claims("jwks", nil))
+	_, err = Scopes(token)
+	assert.NoError(err)
+	token = signToken(t, jwtgo.SigningMethodRS256, rsaKey, "ed1", claims("jwks", nil))
+	_, err = Scopes(token)
+	assert.Error(err, "kid of another key")
+	token = signToken(t, jwtgo.SigningMethodHS256, []byte("secret"), "", claims("jwks", nil))
+	_, err = Scopes(token)
+	assert.Error(err, "HMAC is never allowed")
+
+	// invalid issuers
+	assert.Error(SetIssuers([]Issuer{{Issuer: "nokeys"}}))
+	assert.Error(SetIssuers([]Issuer{{Algorithms: []string{"HS256"}, Keys: ecKeysToKeys(ecKeys)}}))
+}
+
+func TestParsePublicKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	b, err := ioutil.ReadFile("./devcert/jwt_pub.pem")
+	if !assert.NoError(err) {
+		return
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if !assert.NoError(err) {
+		return
+	}
+	b = append(b, pemPublicKey(t, edPub)...)
+
+	keys, err := ParsePublicKeys(b)
+	if assert.NoError(err) && assert.Len(keys, 2) {
+		assert.IsType(&ecdsa.PublicKey{}, keys[0])
+		assert.Equal(edPub, keys[1])
+	}
+
+	_, err = ParsePublicKeys([]byte("not a key"))
+	assert.Error(err)
+}
+
+// resetIssuers sets the devcert key used by the other tests
+func resetIssuers(t *testing.T) {
+	b, err := ioutil.ReadFile("./devcert/jwt_pub.pem")
+	assert.NoError(t, err)
+	assert.NoError(t, SetJWTPublicKey(string(b)))
+}
+
+func signToken(t *testing.T, method jwtgo.SigningMethod, key interface{}, kid string, claims jwtgo.MapClaims) string {
+	token := jwtgo.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal("failed to sign token: " + err.Error())
+	}
+	return signed
+}
+
+func pemPublicKey(t *testing.T, key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func mustECKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func ecKeysToKeys(publicKeys []crypto.PublicKey) []Key {
+	var keys []Key
+	for _, key := range publicKeys {
+		keys = append(keys, Key{Key: key})
+	}
+	return keys
+}
@@ -3,10 +3,11 @@ package jwt
 
 import (
 	"bytes"
-	"crypto"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -30,97 +31,122 @@ MHYwEAYHKoZIzj0CAQYFK4EEACIDYgAES5X8XrfKdx9gYayFITc89wad4usrk0n2
 )
 
 var (
-	jwtCache     *ccache.Cache
-	iyoPublicKey crypto.PublicKey
+	jwtCache *ccache.Cache
+	// entries cached in an older generation are purged when read
+	jwtCacheGeneration int64
+)
+
+// package errors
+var (
+	// ErrMissingScope is returned when a valid JWT lacks the scope required for an action
+	ErrMissingScope = errors.New("JWT does not contain a scope Zedis requires")
 )
 
 type jwtCacheVal struct {
-	err    error
-	scopes []string
+	err        error
+	scopes     []string
+	identity   tokenIdentity
+	generation int64
 }
 
 func init() {
-	var err error
-	iyoPublicKey, err = jwtgo.ParseECPublicKeyFromPEM([]byte(iyoPublicKeyStr))
+	conf := ccache.Configure()
+	conf.MaxSize(jwtCacheSize)
+	jwtCache = ccache.New(conf)
+
+	// itsyou.online is the trusted issuer unless configured otherwise
+	err := SetDefaultIssuer()
 	if err != nil {
 		log.Errorf("failed to parse pub key:%v", err)
 		os.Exit(1)
 	}
+}
 
-	conf := ccache.Configure()
-	conf.MaxSize(jwtCacheSize)
-	jwtCache = ccache.New(conf)
+// SetDefaultIssuer makes itsyou.online the only trusted issuer
+func SetDefaultIssuer() error {
+	return SetJWTPublicKey(iyoPublicKeyStr)
 }
 
-// SetJWTPublicKey configure the public key used to verify JWT token
+// SetJWTPublicKey configures a single trusted issuer
+// signing ES384 JWTs with given PEM encoded public key
 func SetJWTPublicKey(key string) error {
-	var err error
-	iyoPublicKey, err = jwtgo.ParseECPublicKeyFromPEM([]byte(key))
+	publicKey, err := jwtgo.ParseECPublicKeyFromPEM([]byte(key))
 	if err != nil {
 		return err
 	}
-	return nil
+	return SetIssuers([]Issuer{{
+		Algorithms: []string{jwtgo.SigningMethodES384.Alg()},
+		Keys:       []Key{{Key: publicKey}},
+	}})
 }
 
 // ValidatePermission checks if the token has set permission
 // getExpectedScopes is optional, if nil it will check if the JWT has a scope within zedis namespace
 // if not nil it will check if JWT has a scope returned from getExpectedScopes
 func ValidatePermission(jwtStr, organization, namespace string, getExpectedScopes GetScopes) error {
-	var scopes []string
-	var inCache bool
-	var exp int64
-	var err error
-	var hasValidScope bool
-
-	scopes, inCache, err = getScopesFromCache(jwtStr)
+	scopes, err := cachedScopes(jwtStr)
 	if err != nil {
-		// invalid cached token
 		return err
 	}
 
-	if !inCache {
-		scopes, err = getScopes(jwtStr)
-		if err != nil {
-			cacheVal := jwtCacheVal{
-				err: err,
-			}
-			jwtCache.Set(jwtStr, cacheVal, 24*time.Hour)
-			return err
-		}
+	// the token itself is not cached as invalid,
+	// it could have the scopes required for other actions
+	if !HasScopes(scopes, organization, namespace, getExpectedScopes) {
+		return ErrMissingScope
 	}
 
+	return nil
+}
+
+// HasScopes checks scopes the way ValidatePermission checks the scopes of a JWT
+func HasScopes(scopes []string, organization, namespace string, getExpectedScopes GetScopes) bool {
 	if getExpectedScopes == nil {
-		hasValidScope = checkInNamespace(organization, namespace, scopes)
-	} else {
-		hasValidScope = checkPermissions(getExpectedScopes(organization, namespace), scopes)
+		return checkInNamespace(organization, namespace, scopes)
 	}
+	return checkPermissions(getExpectedScopes(organization, namespace), scopes)
+}
 
-	if !hasValidScope {
-		err = fmt.Errorf("JWT does not contain a scope Zedis requires")
-		cacheVal := jwtCacheVal{
-			err: err,
-		}
-		jwtCache.Set(jwtStr, cacheVal, 24*time.Hour)
-		return err
+// Scopes returns the scopes of a valid JWT
+func Scopes(jwtStr string) ([]string, error) {
+	scopes, err := cachedScopes(jwtStr)
+	if err != nil {
+		return nil, err
 	}
 
-	if !inCache {
-		exp, err = checkJWTExpiration(jwtStr)
-		if err != nil {
-			cacheVal := jwtCacheVal{
-				err: err,
-			}
-			jwtCache.Set(jwtStr, cacheVal, 24*time.Hour)
-			return err
-		}
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		result = append(result, removeScopePrefix(scope))
+	}
+	return result, nil
+}
 
-		cacheVal := jwtCacheVal{
-			scopes: scopes,
-		}
-		jwtCache.Set(jwtStr, cacheVal, time.Until(time.Unix(exp, 0)))
+// Subject returns the subject claim of a valid JWT, empty when it has none
+func Subject(jwtStr string) (string, error) {
+	cacheVal, err := cachedToken(jwtStr)
+	if err != nil {
+		return "", err
 	}
+	return cacheVal.identity.subject, nil
+}
 
-	return nil
+// Namespaces returns the namespaces of an organization found in scopes
+// (e.g.: ns for the scopes org.ns and org.ns.read)
+func Namespaces(organization string, scopes []string) []string {
+	var namespaces []string
+	found := make(map[string]struct{})
+	for _, scope := range scopes {
+		scope = removeScopePrefix(scope)
+		if !strings.HasPrefix(scope, organization+".") {
+			continue
+		}
+		namespace := strings.SplitN(scope[len(organization)+1:], ".", 2)[0]
+		if _, ok := found[namespace]; ok || namespace == "" {
+			continue
+		}
+		found[namespace] = struct{}{}
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces
 }
 
 // GetScopes defines a function that fetches scopes
@@ -142,6 +168,21 @@ func WriteScopes(organization, namespace string) []string {
 	}
 }
 
+// SuffixScopes returns a GetScopes that requires the admin scope of the namespace
+// or the namespace scope with given suffix (e.g.: ".read")
+// an empty suffix only accepts the admin scope
+func SuffixScopes(suffix string) GetScopes {
+	if suffix == "" {
+		return AdminScopes
+	}
+	return func(organization, namespace string) []string {
+		return []string{
+			organization + "." + namespace,
+			organization + "." + namespace + suffix,
+		}
+	}
+}
+
 // AdminScopes returns the required admin scopes for Zedis
 func AdminScopes(organization, namespace string) []string {
 	return []string{
@@ -149,19 +190,91 @@ func AdminScopes(organization, namespace string) []string {
 	}
 }
 
+// cachedScopes returns the scopes of a JWT,
+// the JWT is parsed and cached when not in the cache yet
+// revoked JWTs are checked on every call, as revocations can change while cached
+func cachedScopes(jwtStr string) ([]string, error) {
+	cacheVal, err := cachedToken(jwtStr)
+	if err != nil {
+		return nil, err
+	}
+	return cacheVal.scopes, nil
+}
+
+// cachedToken returns the scopes and identity of a valid JWT,
+// the JWT is parsed and cached when not in the cache yet
+func cachedToken(jwtStr string) (jwtCacheVal, error) {
+	cacheVal, inCache, err := getScopesFromCache(jwtStr)
+	if err != nil {
+		// invalid cached token
+		return jwtCacheVal{}, err
+	}
+	if inCache {
+		if isRevoked(cacheVal.identity) {
+			return jwtCacheVal{}, ErrRevoked
+		}
+		return cacheVal, nil
+	}
+
+	// read before parsing, so a purge while parsing purges this entry as well
+	generation := atomic.LoadInt64(&jwtCacheGeneration)
+	scopes, identity, err := getScopes(jwtStr)
+	if err != nil {
+		cacheVal := jwtCacheVal{
+			err:        err,
+			generation: generation,
+		}
+		jwtCache.Set(jwtStr, cacheVal, 24*time.Hour)
+		return jwtCacheVal{}, err
+	}
+
+	exp, err := checkJWTExpiration(jwtStr)
+	if err != nil {
+		cacheVal := jwtCacheVal{
+			err:        err,
+			generation: generation,
+		}
+		jwtCache.Set(jwtStr, cacheVal, 24*time.Hour)
+		return jwtCacheVal{}, err
+	}
+
+	cacheVal = jwtCacheVal{
+		scopes:     scopes,
+		identity:   identity,
+		generation: generation,
+	}
+	jwtCache.Set(jwtStr, cacheVal, time.Until(time.Unix(exp, 0)))
+	if isRevoked(identity) {
+		return jwtCacheVal{}, ErrRevoked
+	}
+	return cacheVal, nil
+}
+
+// purgeCache purges all cached JWTs
+// ccache's Clear isn't safe for concurrent use, so entries are purged when read
+func purgeCache() {
+	atomic.AddInt64(&jwtCacheGeneration, 1)
+}
+
 // get scopes from the cache
-func getScopesFromCache(jwtStr string) ([]string, bool, error) {
+func getScopesFromCache(jwtStr string) (jwtCacheVal, bool, error) {
 	exists := false
 	item := jwtCache.Get(jwtStr)
 	if item == nil {
-		return nil, exists, nil
+		return jwtCacheVal{}, exists, nil
 	}
 	exists = true
 
-	// check validity
+	// purged entry
 	cacheVal := item.Value().(jwtCacheVal)
+	if cacheVal.generation != atomic.LoadInt64(&jwtCacheGeneration) {
+		jwtCache.Delete(jwtStr)
+		return jwtCacheVal{}, false, nil
+	}
+
+	// check validity
 	if cacheVal.err != nil {
-		return nil, exists, cacheVal.err
+		return cacheVal, exists, cacheVal.err
 	}
 
 	// check cache expiration
@@ -169,32 +282,21 @@ func getScopesFromCache(jwtStr string) ([]string, bool, error) {
 		// check JWT expired
 		exp, err := checkJWTExpiration(jwtStr)
 		if err != nil {
-			return nil, exists, err
+			return cacheVal, exists, err
 		}
 		// falsely expired in cache, set back into cache
 		jwtCache.Set(jwtStr, cacheVal, time.Until(time.Unix(exp, 0)))
 	}
 
-	return cacheVal.scopes, exists, nil
+	return cacheVal, exists, nil
 }
 
 func checkJWTExpiration(jwtStr string) (int64, error) {
-	token, err := jwtgo.Parse(jwtStr, func(token *jwtgo.Token) (interface{}, error) {
-		if token.Method != jwtgo.SigningMethodES384 {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return iyoPublicKey, nil
-	})
-
+	claims, err := parseToken(jwtStr)
 	if err != nil {
 		return 0, err
 	}
 
-	claims, ok := token.Claims.(jwtgo.MapClaims)
-	if !(ok && token.Valid) {
-		return 0, fmt.Errorf("invalid JWT token")
-	}
-
 	expFloat, ok := claims["exp"].(float64)
 	if !ok {
 		return 0, fmt.Errorf("invalid expiration claims in token")
@@ -207,27 +309,32 @@ func checkJWTExpiration(jwtStr string) (int64, error) {
 	return exp, nil
 }
 
-func getScopes(jwtStr string) ([]string, error) {
-	token, err := jwtgo.Parse(jwtStr, func(token *jwtgo.Token) (interface{}, error) {
-		if token.Method != jwtgo.SigningMethodES384 {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return iyoPublicKey, nil
-	})
+// getScopes returns the scopes and identity of a JWT
+func getScopes(jwtStr string) ([]string, tokenIdentity, error) {
+	claims, err := parseToken(jwtStr)
 	if err != nil {
-		return nil, err
-	}
-	claims, ok := token.Claims.(jwtgo.MapClaims)
-	if !(ok && token.Valid) {
-		return nil, fmt.Errorf("invalid JWT token")
+		return nil, tokenIdentity{}, err
 	}
 
 	var scopes []string
-	for _, v := range claims["scope"].([]interface{}) {
-		scopes = append(scopes, v.(string))
+	switch scope := claims["scope"].(type) {
+	case []interface{}:
+		for _, v := range scope {
+			s, ok := v.(string)
+			if !ok {
+				return nil, tokenIdentity{}, fmt.Errorf("invalid scope claim in token")
+			}
+			scopes = append(scopes, s)
+		}
+	case string:
+		// space separated scopes, as used by OAuth2 providers
+		scopes = strings.Fields(scope)
+	case nil:
+	default:
+		return nil, tokenIdentity{}, fmt.Errorf("invalid scope claim in token")
 	}
 
-	return scopes, nil
+	return scopes, identityFromClaims(claims), nil
 }
 
 // CheckPermissions checks whether user has needed scopes
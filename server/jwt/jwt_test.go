@@ -90,6 +90,64 @@ func TestValidatePermissionWithScopes(t *testing.T) {
 	assert.NoError(err, "admin should have write access")
 }
 
+func TestValidatePermissionMissingScopeNotCached(t *testing.T) {
+	assert := assert.New(t)
+	writeToken := getToken(t, 24, itsyouonline.Permission{Write: true}, org, namespace)
+
+	err := ValidatePermission(writeToken, org, namespace, ReadScopes)
+	assert.Equal(ErrMissingScope, err)
+
+	// a missing scope for one action doesn't invalidate the token for others
+	err = ValidatePermission(writeToken, org, namespace, WriteScopes)
+	assert.NoError(err)
+	err = ValidatePermission(writeToken, org, namespace, ReadScopes)
+	assert.Equal(ErrMissingScope, err)
+}
+
+func TestSuffixScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(ReadScopes(org, namespace), SuffixScopes(".read")(org, namespace))
+	assert.Equal(WriteScopes(org, namespace), SuffixScopes(".write")(org, namespace))
+	assert.Equal(AdminScopes(org, namespace), SuffixScopes("")(org, namespace))
+	assert.Equal([]string{
+		org + "." + namespace,
+		org + "." + namespace + ".delete",
+	}, SuffixScopes(".delete")(org, namespace))
+}
+
+func TestScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	readToken := getToken(t, 24, itsyouonline.Permission{Read: true}, org, namespace)
+	scopes, err := Scopes(readToken)
+	if assert.NoError(err) {
+		assert.Contains(scopes, org+"."+namespace+".read")
+		for _, scope := range scopes {
+			assert.Equal(removeScopePrefix(scope), scope, "scopes should not be prefixed")
+		}
+	}
+
+	expiredToken := getToken(t, -24, itsyouonline.Permission{Read: true}, org, namespace)
+	_, err = Scopes(expiredToken)
+	assert.Error(err)
+}
+
+func TestNamespaces(t *testing.T) {
+	assert := assert.New(t)
+
+	scopes := []string{
+		"user:memberof:org.tenant1",
+		"org.tenant1.read",
+		"org.tenant2.write",
+		"otherorg.tenant3",
+		"organization.tenant4",
+		"org",
+	}
+	assert.Equal([]string{"tenant1", "tenant2"}, Namespaces("org", scopes))
+	assert.Empty(Namespaces("none", scopes))
+}
+
 func TestRemoveScopePrefix(t *testing.T) {
 	assert := assert.New(t)
 
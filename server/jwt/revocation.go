@@ -0,0 +1,174 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+var (
+	// ErrRevoked is returned for a JWT matching the revocation list
+	ErrRevoked = errors.New("JWT has been revoked")
+
+	revokedIDs      = make(map[string]struct{})
+	revokedSubjects = make(map[string]int64)
+	// JWTs issued before this unix time are revoked
+	revokedBefore  int64
+	revocationLock = new(sync.RWMutex)
+)
+
+// tokenIdentity holds the claims a JWT can be revoked by
+type tokenIdentity struct {
+	id      string
+	subject string
+	// unix time the JWT was issued at, 0 when unknown
+	issuedAt int64
+}
+
+func identityFromClaims(claims jwtgo.MapClaims) tokenIdentity {
+	var identity tokenIdentity
+	identity.id, _ = claims["jti"].(string)
+	identity.subject, _ = claims["sub"].(string)
+	if iat, ok := claims["iat"].(float64); ok {
+		identity.issuedAt = int64(iat)
+	}
+	return identity
+}
+
+// isRevoked checks a JWT against the revocation list
+// a JWT without iat claim is considered issued before any revocation time
+func isRevoked(identity tokenIdentity) bool {
+	revocationLock.RLock()
+	defer revocationLock.RUnlock()
+
+	if identity.issuedAt < revokedBefore {
+		return true
+	}
+	if _, ok := revokedIDs[identity.id]; ok && identity.id != "" {
+		return true
+	}
+	if before, ok := revokedSubjects[identity.subject]; ok && identity.subject != "" {
+		return identity.issuedAt < before
+	}
+	return false
+}
+
+// RevokeID revokes the JWT with given jti claim
+func RevokeID(id string) {
+	revocationLock.Lock()
+	revokedIDs[id] = struct{}{}
+	revocationLock.Unlock()
+	purgeCache()
+}
+
+// RevokeSubject revokes the JWTs with given sub claim issued before a time
+func RevokeSubject(subject string, issuedBefore time.Time) {
+	revocationLock.Lock()
+	revokedSubjects[subject] = issuedBefore.Unix()
+	revocationLock.Unlock()
+	purgeCache()
+}
+
+// RevokeIssuedBefore revokes all JWTs issued before a time
+func RevokeIssuedBefore(issuedBefore time.Time) {
+	revocationLock.Lock()
+	revokedBefore = issuedBefore.Unix()
+	revocationLock.Unlock()
+	purgeCache()
+}
+
+// UnrevokeID removes a jti from the revocation list
+// returns false if it wasn't revoked
+func UnrevokeID(id string) bool {
+	revocationLock.Lock()
+	defer revocationLock.Unlock()
+	_, ok := revokedIDs[id]
+	delete(revokedIDs, id)
+	return ok
+}
+
+// UnrevokeSubject removes a subject from the revocation list
+// returns false if it wasn't revoked
+func UnrevokeSubject(subject string) bool {
+	revocationLock.Lock()
+	defer revocationLock.Unlock()
+	_, ok := revokedSubjects[subject]
+	delete(revokedSubjects, subject)
+	return ok
+}
+
+// UnrevokeIssuedBefore stops revoking JWTs by the time they were issued
+// returns false if no such time was set
+func UnrevokeIssuedBefore() bool {
+	revocationLock.Lock()
+	defer revocationLock.Unlock()
+	ok := revokedBefore != 0
+	revokedBefore = 0
+	return ok
+}
+
+// Revocations returns the revocation list, sorted, one revocation per line:
+//	id <jti>
+//	subject <sub> <issued before unix time>
+//	before <issued before unix time>
+func Revocations() []string {
+	revocationLock.RLock()
+	defer revocationLock.RUnlock()
+
+	lines := make([]string, 0, len(revokedIDs)+len(revokedSubjects)+1)
+	if revokedBefore != 0 {
+		lines = append(lines, "before "+strconv.FormatInt(revokedBefore, 10))
+	}
+	for id := range revokedIDs {
+		lines = append(lines, "id "+id)
+	}
+	for subject, before := range revokedSubjects {
+		lines = append(lines, "subject "+subject+" "+strconv.FormatInt(before, 10))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// SetRevocations replaces the revocation list with the revocations in the format of Revocations
+// the list is untouched when one of the lines is invalid
+func SetRevocations(lines []string) error {
+	ids := make(map[string]struct{})
+	subjects := make(map[string]int64)
+	var before int64
+
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var err error
+		switch {
+		case fields[0] == "id" && len(fields) == 2:
+			ids[fields[1]] = struct{}{}
+		case fields[0] == "subject" && len(fields) == 3:
+			subjects[fields[1]], err = strconv.ParseInt(fields[2], 10, 64)
+		case fields[0] == "before" && len(fields) == 2:
+			before, err = strconv.ParseInt(fields[1], 10, 64)
+		default:
+			err = errors.New("should be id <jti>, subject <sub> <unix time> or before <unix time>")
+		}
+		if err != nil {
+			return fmt.Errorf("invalid revocation on line %d: %v", i+1, err)
+		}
+	}
+
+	revocationLock.Lock()
+	revokedIDs = ids
+	revokedSubjects = subjects
+	revokedBefore = before
+	revocationLock.Unlock()
+	purgeCache()
+	return nil
+}
@@ -0,0 +1,93 @@
+package jwt
+
+import (
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevocations(t *testing.T) {
+	assert := assert.New(t)
+	defer SetRevocations(nil)
+
+	b, err := ioutil.ReadFile("./devcert/jwt_key.pem")
+	if !assert.NoError(err) {
+		return
+	}
+	key, err := jwtgo.ParseECPrivateKeyFromPEM(b)
+	if !assert.NoError(err) {
+		return
+	}
+	now := time.Now()
+	token := func(jti, sub string, iat time.Time) string {
+		return signToken(t, jwtgo.SigningMethodES384, key, "", jwtgo.MapClaims{
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   iat.Unix(),
+			"jti":   jti,
+			"sub":   sub,
+			"scope": []string{org + "." + namespace},
+		})
+	}
+	aliceOld := token("1", "alice", now.Add(-time.Hour))
+	aliceNew := token("2", "alice", now)
+	bob := token("3", "bob", now.Add(-time.Hour))
+
+	// cached tokens are revoked as well
+	for _, jwtStr := range []string{aliceOld, aliceNew, bob} {
+		assert.NoError(ValidatePermission(jwtStr, org, namespace, nil))
+	}
+
+	RevokeID("3")
+	assert.Equal(ErrRevoked, ValidatePermission(bob, org, namespace, nil))
+	assert.NoError(ValidatePermission(aliceOld, org, namespace, nil))
+
+	RevokeSubject("alice", now.Add(-time.Minute))
+	_, err = Scopes(aliceOld)
+	assert.Equal(ErrRevoked, err)
+	_, err = Scopes(aliceNew)
+	assert.NoError(err, "issued after the revocation")
+
+	assert.Equal([]string{
+		"id 3",
+		"subject alice " + strconv.FormatInt(now.Add(-time.Minute).Unix(), 10),
+	}, Revocations())
+
+	assert.True(UnrevokeID("3"))
+	assert.False(UnrevokeID("3"))
+	assert.NoError(ValidatePermission(bob, org, namespace, nil))
+
+	RevokeIssuedBefore(now.Add(-time.Minute))
+	assert.Equal(ErrRevoked, ValidatePermission(bob, org, namespace, nil))
+	assert.True(UnrevokeIssuedBefore())
+	assert.True(UnrevokeSubject("alice"))
+	assert.Empty(Revocations())
+	assert.NoError(ValidatePermission(aliceOld, org, namespace, nil))
+
+	// tokens without iat are revoked by issued before revocations
+	withoutIat := signToken(t, jwtgo.SigningMethodES384, key, "", jwtgo.MapClaims{
+		"exp":   now.Add(time.Hour).Unix(),
+		"scope": []string{org + "." + namespace},
+	})
+	RevokeIssuedBefore(now.Add(-time.Hour))
+	assert.Equal(ErrRevoked, ValidatePermission(withoutIat, org, namespace, nil))
+}
+
+func TestSetRevocations(t *testing.T) {
+	assert := assert.New(t)
+	defer SetRevocations(nil)
+
+	lines := []string{"before 100", "id abc", "subject alice 200"}
+	assert.NoError(SetRevocations(append(lines, "")))
+	assert.Equal(lines, Revocations())
+
+	// invalid lists don't replace the revocations
+	assert.Error(SetRevocations([]string{"id abc def"}))
+	assert.Error(SetRevocations([]string{"subject alice"}))
+	assert.Error(SetRevocations([]string{"before soon"}))
+	assert.Error(SetRevocations([]string{"user alice"}))
+	assert.Equal(lines, Revocations())
+}
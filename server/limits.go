@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/config"
+)
+
+var (
+	errMaxClients      = errors.New("max number of clients reached")
+	errMaxClientsPerIP = errors.New("max number of clients per IP address reached")
+
+	// admitted connections, in total and by IP address
+	clientCount       int
+	clientCountByHost = make(map[string]int)
+	clientCountLock   sync.Mutex
+
+	// token buckets of the rate limits, by subject and category
+	rateBuckets     = make(map[rateBucketKey]*tokenBucket)
+	rateBucketsLock sync.Mutex
+	// last time full buckets were dropped
+	rateBucketsPruned time.Time
+)
+
+// interval at which buckets that filled up again are dropped
+const rateBucketPruneInterval = time.Minute
+
+// admitClient counts a new connection for the client limits
+// an error is returned when a limit is reached
+func admitClient(conn redcon.Conn) error {
+	host := remoteHost(remoteAddr(conn))
+	zc := zConfig()
+
+	clientCountLock.Lock()
+	defer clientCountLock.Unlock()
+	if zc.MaxClients > 0 && clientCount >= zc.MaxClients {
+		rejectedConns.add("maxclients", 1)
+		return errMaxClients
+	}
+	if zc.MaxClientsPerIP > 0 && host != "" && clientCountByHost[host] >= zc.MaxClientsPerIP {
+		rejectedConns.add("maxclients_per_ip", 1)
+		return errMaxClientsPerIP
+	}
+	clientCount++
+	if host != "" {
+		clientCountByHost[host]++
+	}
+	c := getClient(conn)
+	c.admitted = true
+	c.host = host
+	return nil
+}
+
+// releaseClient stops counting a connection for the client limits
+func releaseClient(c *client) {
+	if !c.admitted {
+		return
+	}
+	clientCountLock.Lock()
+	defer clientCountLock.Unlock()
+	clientCount--
+	if c.host == "" {
+		return
+	}
+	clientCountByHost[c.host]--
+	if clientCountByHost[c.host] <= 0 {
+		delete(clientCountByHost, c.host)
+	}
+}
+
+// connectedClients returns the amount of admitted connections
+func connectedClients() int {
+	clientCountLock.Lock()
+	defer clientCountLock.Unlock()
+	return clientCount
+}
+
+// remoteHost returns the IP address of a remote address
+// empty for the unnamed address of a Unix socket connection
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// rateSubject returns the subject the rate limits of the connection apply to
+// unauthenticated connections are limited by IP address, or together when using the Unix socket
+func (c *client) rateSubject() string {
+	switch {
+	case c.user != "":
+		return "user:" + c.user
+	case c.jwtSubject != "":
+		return "jwt:" + c.jwtSubject
+	case c.certSubject != "":
+		return "cert:" + c.certSubject
+	case c.host == "":
+		return "unix"
+	}
+	return "ip:" + c.host
+}
+
+// withinRateLimits takes a token of the rate limits of the command's categories
+// an error is written to the connection when one of them is exceeded
+func withinRateLimits(conn redcon.Conn, c *command) bool {
+	limits := zConfig().RateLimits
+	if len(limits) == 0 {
+		return true
+	}
+	var categories []string
+	for _, category := range c.categories {
+		if _, ok := limits[category]; ok {
+			categories = append(categories, category)
+		}
+	}
+	if len(categories) == 0 {
+		return true
+	}
+
+	exceeded, ok := takeTokens(getClient(conn).rateSubject(), categories, limits, time.Now())
+	if !ok {
+		rateLimited.add(exceeded, 1)
+		conn.WriteError("ERR rate limit of " + exceeded + " commands exceeded, try again later")
+		return false
+	}
+	return true
+}
+
+// rateBucketKey identifies the token bucket of a subject for a category
+type rateBucketKey struct {
+	subject  string
+	category string
+}
+
+// tokenBucket holds the tokens left of a rate limit
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens gained since the bucket was last used
+func (b *tokenBucket) refill(limit config.RateLimit, now time.Time) {
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+}
+
+// takeTokens takes a token of the buckets of a subject for all categories
+// no tokens are taken when a bucket is empty, the category of that bucket is returned
+func takeTokens(subject string, categories []string, limits map[string]config.RateLimit, now time.Time) (string, bool) {
+	rateBucketsLock.Lock()
+	defer rateBucketsLock.Unlock()
+
+	if now.Sub(rateBucketsPruned) >= rateBucketPruneInterval {
+		pruneRateBuckets(limits, now)
+	}
+
+	buckets := make([]*tokenBucket, len(categories))
+	for i, category := range categories {
+		key := rateBucketKey{subject: subject, category: category}
+		b, ok := rateBuckets[key]
+		if !ok {
+			b = &tokenBucket{tokens: float64(limits[category].Burst), last: now}
+			rateBuckets[key] = b
+		}
+		b.refill(limits[category], now)
+		if b.tokens < 1 {
+			return category, false
+		}
+		buckets[i] = b
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return "", true
+}
+
+// pruneRateBuckets drops the buckets that filled up again, or which category is no longer limited
+// rateBucketsLock must be held
+func pruneRateBuckets(limits map[string]config.RateLimit, now time.Time) {
+	for key, b := range rateBuckets {
+		limit, ok := limits[key.category]
+		if ok {
+			b.refill(limit, now)
+		}
+		if !ok || b.tokens >= float64(limit.Burst) {
+			delete(rateBuckets, key)
+		}
+	}
+	rateBucketsPruned = now
+}
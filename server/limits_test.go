@@ -0,0 +1,137 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/config"
+)
+
+func TestAdmitClient(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.MaxClients = 3
+	cfg.MaxClientsPerIP = 2
+	setZConfig(&cfg)
+
+	newConn := func(addr string) *addrConn {
+		return &addrConn{addr: addr}
+	}
+	a1, a2, a3 := newConn("10.0.0.1:1000"), newConn("10.0.0.1:1001"), newConn("10.0.0.1:1002")
+	b1, b2 := newConn("10.0.0.2:1000"), newConn("10.0.0.2:1001")
+
+	assert.NoError(admitClient(a1))
+	assert.NoError(admitClient(a2))
+	assert.Equal(errMaxClientsPerIP, admitClient(a3))
+	assert.NoError(admitClient(b1))
+	assert.Equal(errMaxClients, admitClient(b2))
+	assert.Equal(3, connectedClients())
+
+	removeClient(a1)
+	assert.NoError(admitClient(a3), "released connections don't count")
+	removeClient(b2)
+	assert.Equal(3, connectedClients(), "rejected connections are never counted")
+
+	for _, conn := range []redcon.Conn{a2, a3, b1} {
+		removeClient(conn)
+	}
+	assert.Equal(0, connectedClients())
+	assert.Empty(clientCountByHost)
+}
+
+func TestRejectTLSConnection(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.MaxClientsPerIP = 1
+	setZConfig(&cfg)
+
+	first := &addrConn{addr: "192.0.2.1:1000"}
+	assert.True(accept("tls")(first))
+	defer closed("tls")(first, nil)
+
+	// a reply would need the handshake, which the client may never start
+	server, client := net.Pipe()
+	defer client.Close()
+	refused := &addrConn{stubConn: stubConn{conn: tls.Server(server, new(tls.Config))}, addr: "192.0.2.1:1001"}
+	assert.False(accept("tls")(refused))
+	assert.Empty(refused.s, "TLS connections are refused without a reply")
+
+	plain := &addrConn{addr: "192.0.2.1:1002"}
+	assert.False(accept("plain")(plain))
+	assert.Equal("ERR "+errMaxClientsPerIP.Error(), plain.s)
+}
+
+func TestTakeTokens(t *testing.T) {
+	assert := assert.New(t)
+	limits := map[string]config.RateLimit{
+		"@read":  {Rate: 1, Burst: 2},
+		"@write": {Rate: 10, Burst: 1},
+	}
+	now := time.Now()
+	both := []string{"@read", "@write"}
+
+	_, ok := takeTokens("jwt:takeTokens", both, limits, now)
+	assert.True(ok)
+	category, ok := takeTokens("jwt:takeTokens", both, limits, now)
+	assert.False(ok)
+	assert.Equal("@write", category)
+
+	_, ok = takeTokens("jwt:takeTokens", []string{"@read"}, limits, now)
+	assert.True(ok, "no tokens are taken when a bucket is empty")
+	_, ok = takeTokens("jwt:takeTokens", []string{"@read"}, limits, now)
+	assert.False(ok)
+	_, ok = takeTokens("jwt:other", []string{"@read"}, limits, now)
+	assert.True(ok, "subjects have their own buckets")
+
+	_, ok = takeTokens("jwt:takeTokens", both, limits, now.Add(time.Second))
+	assert.True(ok, "buckets refill over time")
+
+	// buckets that filled up again are dropped
+	takeTokens("jwt:takeTokens", nil, limits, now.Add(time.Hour))
+	for key := range rateBuckets {
+		assert.NotEqual("jwt:takeTokens", key.subject)
+	}
+}
+
+func TestWithinRateLimits(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.RateLimits = map[string]config.RateLimit{"@write": {Rate: 0.001, Burst: 1}}
+	setZConfig(&cfg)
+
+	conn := new(stubConn)
+	defer removeClient(conn)
+	getClient(conn).user = "withinRateLimits"
+	assert.True(withinRateLimits(conn, commands["set"]))
+	assert.False(withinRateLimits(conn, commands["set"]))
+	assert.Equal("ERR rate limit of @write commands exceeded, try again later", conn.s)
+	assert.True(withinRateLimits(conn, commands["get"]), "categories without limit")
+	assert.True(rateLimited.value("@write") >= 1)
+}
+
+func TestRateSubject(t *testing.T) {
+	assert := assert.New(t)
+	c := &client{host: "10.0.0.1"}
+	assert.Equal("ip:10.0.0.1", c.rateSubject())
+	c.certSubject = "backup"
+	assert.Equal("cert:backup", c.rateSubject())
+	c.jwtSubject = "alice"
+	assert.Equal("jwt:alice", c.rateSubject())
+	c.user = "bob"
+	assert.Equal("user:bob", c.rateSubject())
+}
+
+// addrConn is a connection with a remote address
+type addrConn struct {
+	stubConn
+	addr string
+}
+
+func (c *addrConn) RemoteAddr() string { return c.addr }
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/config"
+)
+
+// listenAndServe serves Redis on a configured listener
+func listenAndServe(l config.Listener, tlsCfg *tls.Config) error {
+	var ln net.Listener
+	var err error
+	if l.Network == "unix" {
+		ln, err = listenUnix(l.Address, l.PermMode)
+	} else {
+		ln, err = net.Listen(l.Network, l.Address)
+	}
+	if err != nil {
+		return err
+	}
+	if l.ProxyProtocol {
+		ln = proxyListener{ln}
+	}
+	if l.TLS {
+		ln = tls.NewListener(ln, tlsCfg)
+	}
+
+	log.Infof("Redis interface %s listening at %s", l.Name, l.Address)
+	defer log.Infof("Redis interface %s closed", l.Name)
+	return redcon.Serve(ln, handler, accept(l.Name), closed(l.Name))
+}
+
+// needsTLS returns true when the TLS port or a listener serves TLS
+func needsTLS(cfg *config.Zedis) bool {
+	if cfg.TLSPort != "" {
+		return true
+	}
+	for _, l := range cfg.Listeners {
+		if l.TLS {
+			return true
+		}
+	}
+	return false
+}
+
+// validateListenerCommands checks if the commands allowed on the listeners are supported
+func validateListenerCommands(cfg *config.Zedis) error {
+	for _, l := range cfg.Listeners {
+		for _, name := range l.Commands {
+			if !knownCommandOrCategory(name) {
+				return fmt.Errorf("unknown command or category %q in the commands of listener %s", name, l.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// knownCommandOrCategory returns true for the name of a supported command or the category of one
+func knownCommandOrCategory(name string) bool {
+	if !strings.HasPrefix(name, "@") {
+		_, ok := commands[name]
+		return ok
+	}
+	for _, c := range commands {
+		if contains(c.categories, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// listenerAllows checks if the listener of a connection allows a command
+// an error is written to the connection when it doesn't
+func listenerAllows(conn redcon.Conn, c *command) bool {
+	l := zConfig().Listener(getClient(conn).listener)
+	if l == nil {
+		return true
+	}
+	if l.ReadOnly && contains(c.flags, "write") {
+		conn.WriteError("READONLY You can't write against a read only listener.")
+		return false
+	}
+	// connection commands such as AUTH and QUIT are always allowed
+	if len(l.Commands) == 0 || contains(c.categories, "@connection") {
+		return true
+	}
+	for _, name := range l.Commands {
+		if name == c.name || contains(c.categories, name) {
+			return true
+		}
+	}
+	conn.WriteError("ERR command '" + c.name + "' is not allowed on this listener")
+	return false
+}
+
+// listenerAuthCommands returns the commands that require authentication on a listener,
+// and whether all commands do
+func listenerAuthCommands(listener string) (map[string]struct{}, bool) {
+	zc := zConfig()
+	if l := zc.Listener(listener); l != nil && l.AuthCommands != nil {
+		return l.AuthCommands, l.AuthAll
+	}
+	if listener == "unix" && zc.UnixSocketAuthCommands != nil {
+		return zc.UnixSocketAuthCommands, zc.UnixSocketAuthAll
+	}
+	return zc.AuthCommands, zc.AuthAll
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/config"
+)
+
+func TestListenerAllows(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.Listeners = []config.Listener{
+		{Name: "internal", Commands: []string{"get", "@keyspace"}},
+		{Name: "replica", ReadOnly: true},
+	}
+	setZConfig(&cfg)
+
+	conn := new(stubConn)
+	defer removeClient(conn)
+	getClient(conn).listener = "plain"
+	assert.True(listenerAllows(conn, commands["set"]), "listeners of port and tls_port have no policy")
+
+	getClient(conn).listener = "internal"
+	assert.True(listenerAllows(conn, commands["get"]))
+	assert.True(listenerAllows(conn, commands["exists"]), "allowed by category")
+	assert.True(listenerAllows(conn, commands["auth"]), "connection commands are always allowed")
+	assert.False(listenerAllows(conn, commands["set"]))
+	assert.Equal("ERR command 'set' is not allowed on this listener", conn.s)
+
+	conn.s = ""
+	getClient(conn).listener = "replica"
+	assert.True(listenerAllows(conn, commands["get"]))
+	assert.False(listenerAllows(conn, commands["set"]))
+	assert.Equal("READONLY You can't write against a read only listener.", conn.s)
+}
+
+func TestListenerAuthCommands(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.Listeners = []config.Listener{
+		{Name: "internal", AuthCommands: map[string]struct{}{}},
+		{Name: "public"},
+	}
+	setZConfig(&cfg)
+
+	get := redcon.Command{Args: [][]byte{[]byte("GET"), []byte("key")}}
+	conn := new(stubConn)
+	defer removeClient(conn)
+	getClient(conn).listener = "internal"
+	assert.True(authorized(conn, commands["get"], get), "no commands require authentication")
+
+	getClient(conn).listener = "public"
+	assert.False(authorized(conn, commands["get"], get), "auth_commands is used when not set")
+}
+
+func TestValidateListenerCommands(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &config.Zedis{Listeners: []config.Listener{
+		{Name: "internal", Commands: []string{"get", "@read"}},
+	}}
+	assert.NoError(validateListenerCommands(cfg))
+
+	cfg.Listeners[0].Commands = []string{"del"}
+	assert.Error(validateListenerCommands(cfg), "unsupported command")
+
+	cfg.Listeners[0].Commands = []string{"@hash"}
+	assert.Error(validateListenerCommands(cfg), "category of no command")
+}
@@ -0,0 +1,350 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/zero-os/zedis/server/jwt"
+	"github.com/zero-os/zedis/stor"
+)
+
+var (
+	// upper bounds (in seconds) of the latency histogram buckets
+	latencyBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	cmdTotal = newCounterVec("zedis_commands_total",
+		"Number of commands processed, by command.", "command")
+	cmdDuration = newHistogramVec("zedis_command_duration_seconds",
+		"Time spent processing a command, by command.", "command")
+	jwtValidations = newCounterVec("zedis_jwt_validations_total",
+		"Number of JWT permission validations, by outcome.", "outcome")
+	storDuration = newHistogramVec("zedis_stor_duration_seconds",
+		"Time spent in 0-stor calls, by operation.", "operation")
+	storErrors = newCounterVec("zedis_stor_errors_total",
+		"Number of failed 0-stor calls, by operation.", "operation")
+	openConns = newGaugeVec("zedis_connections_open",
+		"Number of open client connections, by listener.", "listener")
+	rejectedConns = newCounterVec("zedis_connections_rejected_total",
+		"Number of connections rejected by the client limits, by limit.", "limit")
+	rateLimited = newCounterVec("zedis_commands_rate_limited_total",
+		"Number of commands rejected by the rate limits, by category.", "category")
+	networkBytes = newCounterVec("zedis_network_bytes_total",
+		"Number of Redis protocol bytes received and sent, by direction.", "direction")
+	certExpiryDays = newGaugeFunc("zedis_tls_certificate_expiry_days",
+		"Days until the served TLS certificate expires.", certDaysLeft)
+
+	// metrics in the order they are exposed
+	allMetrics = []metric{
+		cmdTotal,
+		cmdDuration,
+		jwtValidations,
+		storDuration,
+		storErrors,
+		openConns,
+		rejectedConns,
+		rateLimited,
+		networkBytes,
+		certExpiryDays,
+	}
+)
+
+// listenAndServeMetrics serves the Prometheus metrics over HTTP
+func listenAndServeMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	return http.ListenAndServe(addr, mux)
+}
+
+// metricsHandler writes all metrics in the Prometheus text format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	var buf bytes.Buffer
+	for _, m := range allMetrics {
+		m.write(&buf)
+	}
+	_, err := buf.WriteTo(w)
+	if err != nil {
+		log.Debugf("failed to write metrics to %s: %v", r.RemoteAddr, err)
+	}
+}
+
+// observeCommand records the metrics of a processed command
+func observeCommand(name string, duration time.Duration, bytesIn, bytesOut int) {
+	cmdTotal.add(name, 1)
+	cmdDuration.observe(name, duration.Seconds())
+	networkBytes.add("in", float64(bytesIn))
+	if bytesOut > 0 {
+		networkBytes.add("out", float64(bytesOut))
+	}
+}
+
+// meteredValidator wraps a permission validator to count validation outcomes
+func meteredValidator(validate func(string, string, string, jwt.GetScopes) error) func(string, string, string, jwt.GetScopes) error {
+	return func(jwtStr, organization, namespace string, getExpectedScopes jwt.GetScopes) error {
+		err := validate(jwtStr, organization, namespace, getExpectedScopes)
+		switch err {
+		case nil:
+			jwtValidations.add("ok", 1)
+		case jwt.ErrMissingScope:
+			jwtValidations.add("denied", 1)
+		case jwt.ErrRevoked:
+			jwtValidations.add("revoked", 1)
+		default:
+			jwtValidations.add("invalid", 1)
+		}
+		return err
+	}
+}
+
+// meteredStor wraps a stor client to record latencies and errors
+type meteredStor struct {
+	stor.Client
+}
+
+func (ms meteredStor) Read(ctx context.Context, key []byte) ([]byte, error) {
+	start := time.Now()
+	val, err := ms.Client.Read(ctx, key)
+	observeStor("read", start, err)
+	return val, err
+}
+
+func (ms meteredStor) Write(ctx context.Context, key []byte, value []byte) error {
+	start := time.Now()
+	err := ms.Client.Write(ctx, key, value)
+	observeStor("write", start, err)
+	return err
+}
+
+func (ms meteredStor) KeyExists(ctx context.Context, key []byte) (bool, error) {
+	start := time.Now()
+	found, err := ms.Client.KeyExists(ctx, key)
+	observeStor("key_exists", start, err)
+	return found, err
+}
+
+func observeStor(operation string, start time.Time, err error) {
+	storDuration.observe(operation, time.Since(start).Seconds())
+	if err != nil {
+		storErrors.add(operation, 1)
+	}
+}
+
+// certDaysLeft returns the days left before the served certificate expires
+// with ACME, the certificate expiring first of those served in the last day is used
+func certDaysLeft() (float64, bool) {
+	if zConfig().ACME {
+		return acmeCertDaysLeft()
+	}
+	return selfSignedCertDaysLeft()
+}
+
+// selfSignedCertDaysLeft returns the days left before the self signed or file certificate expires
+func selfSignedCertDaysLeft() (float64, bool) {
+	if certCacheLock == nil {
+		return 0, false
+	}
+	certCacheLock.Lock()
+	defer certCacheLock.Unlock()
+	if certCache == nil || certCache.Leaf == nil {
+		return 0, false
+	}
+	return time.Until(certCache.Leaf.NotAfter).Hours() / 24, true
+}
+
+// metric is a Prometheus metric that can write itself in the text format
+type metric interface {
+	write(w io.Writer)
+}
+
+// metricVec holds the values of a metric family with a single label
+type metricVec struct {
+	name  string
+	help  string
+	label string
+	kind  string
+
+	lock   sync.Mutex
+	values map[string]float64
+}
+
+func (v *metricVec) add(labelValue string, delta float64) {
+	v.lock.Lock()
+	v.values[labelValue] += delta
+	v.lock.Unlock()
+}
+
+func (v *metricVec) value(labelValue string) float64 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.values[labelValue]
+}
+
+func (v *metricVec) total() float64 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	var total float64
+	for _, val := range v.values {
+		total += val
+	}
+	return total
+}
+
+func (v *metricVec) write(w io.Writer) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	writeHeader(w, v.name, v.help, v.kind)
+	for _, lv := range sortedKeys(v.values) {
+		fmt.Fprintf(w, "%s{%s=%q} %s\n", v.name, v.label, lv, formatFloat(v.values[lv]))
+	}
+}
+
+// counterVec is a monotonically increasing metric
+type counterVec struct {
+	metricVec
+}
+
+func newCounterVec(name, help, label string) *counterVec {
+	return &counterVec{metricVec{
+		name:   name,
+		help:   help,
+		label:  label,
+		kind:   "counter",
+		values: make(map[string]float64),
+	}}
+}
+
+// gaugeVec is a metric that can go up and down
+type gaugeVec struct {
+	metricVec
+}
+
+func newGaugeVec(name, help, label string) *gaugeVec {
+	return &gaugeVec{metricVec{
+		name:   name,
+		help:   help,
+		label:  label,
+		kind:   "gauge",
+		values: make(map[string]float64),
+	}}
+}
+
+// gaugeFunc is a gauge which value is computed when exposed
+// the metric is omitted when value reports false
+type gaugeFunc struct {
+	name  string
+	help  string
+	value func() (float64, bool)
+}
+
+func newGaugeFunc(name, help string, value func() (float64, bool)) *gaugeFunc {
+	return &gaugeFunc{
+		name:  name,
+		help:  help,
+		value: value,
+	}
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	val, ok := g.value()
+	if !ok {
+		return
+	}
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(val))
+}
+
+// histogramVec samples observations in latencyBuckets
+type histogramVec struct {
+	name  string
+	help  string
+	label string
+
+	lock       sync.Mutex
+	histograms map[string]*histogram
+}
+
+type histogram struct {
+	// counts per bucket, not cumulative
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogramVec(name, help, label string) *histogramVec {
+	return &histogramVec{
+		name:       name,
+		help:       help,
+		label:      label,
+		histograms: make(map[string]*histogram),
+	}
+}
+
+func (v *histogramVec) observe(labelValue string, val float64) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	h, ok := v.histograms[labelValue]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		v.histograms[labelValue] = h
+	}
+	i := sort.SearchFloat64s(latencyBuckets, val)
+	if i < len(h.buckets) {
+		h.buckets[i]++
+	}
+	h.count++
+	h.sum += val
+}
+
+func (v *histogramVec) write(w io.Writer) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	writeHeader(w, v.name, v.help, "histogram")
+
+	labelValues := make([]string, 0, len(v.histograms))
+	for lv := range v.histograms {
+		labelValues = append(labelValues, lv)
+	}
+	sort.Strings(labelValues)
+
+	for _, lv := range labelValues {
+		h := v.histograms[lv]
+		var cumulative uint64
+		for i, upper := range latencyBuckets {
+			cumulative += h.buckets[i]
+			fmt.Fprintf(w, "%s_bucket{%s=%q,le=%q} %d\n", v.name, v.label, lv, formatFloat(upper), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s=%q,le=\"+Inf\"} %d\n", v.name, v.label, lv, h.count)
+		fmt.Fprintf(w, "%s_sum{%s=%q} %s\n", v.name, v.label, lv, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s=%q} %d\n", v.name, v.label, lv, h.count)
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
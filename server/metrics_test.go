@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/server/jwt"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := newCounterVec("test_total", "A test counter.", "kind")
+	c.add("b", 2)
+	c.add("a", 1)
+	c.add("b", 1)
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	assert.Equal(t, `# HELP test_total A test counter.
+# TYPE test_total counter
+test_total{kind="a"} 1
+test_total{kind="b"} 3
+`, buf.String())
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := newHistogramVec("test_seconds", "A test histogram.", "op")
+	h.observe("get", 0.0001)
+	h.observe("get", 0.3)
+	h.observe("get", 60)
+
+	var buf bytes.Buffer
+	h.write(&buf)
+	out := buf.String()
+	assert.Contains(t, out, "# TYPE test_seconds histogram\n")
+	assert.Contains(t, out, `test_seconds_bucket{op="get",le="0.0005"} 1`)
+	assert.Contains(t, out, `test_seconds_bucket{op="get",le="0.25"} 1`)
+	assert.Contains(t, out, `test_seconds_bucket{op="get",le="0.5"} 2`)
+	assert.Contains(t, out, `test_seconds_bucket{op="get",le="10"} 2`)
+	assert.Contains(t, out, `test_seconds_bucket{op="get",le="+Inf"} 3`)
+	assert.Contains(t, out, `test_seconds_count{op="get"} 3`)
+}
+
+func TestGaugeFunc(t *testing.T) {
+	var buf bytes.Buffer
+	g := newGaugeFunc("test_gauge", "A test gauge.", func() (float64, bool) { return 0, false })
+	g.write(&buf)
+	assert.Empty(t, buf.String(), "gauge without value should be omitted")
+
+	g = newGaugeFunc("test_gauge", "A test gauge.", func() (float64, bool) { return 1.5, true })
+	g.write(&buf)
+	assert.Contains(t, buf.String(), "test_gauge 1.5\n")
+}
+
+func TestMeteredValidator(t *testing.T) {
+	ok, invalid, denied := jwtValidations.values["ok"], jwtValidations.values["invalid"], jwtValidations.values["denied"]
+
+	meteredValidator(stubAuthValidator)("jwt", "org", "ns", nil)
+	meteredValidator(stubAuthValidatorErr)("jwt", "org", "ns", nil)
+	meteredValidator(func(string, string, string, jwt.GetScopes) error {
+		return jwt.ErrMissingScope
+	})("jwt", "org", "ns", nil)
+
+	assert.Equal(t, ok+1, jwtValidations.values["ok"])
+	assert.Equal(t, invalid+1, jwtValidations.values["invalid"])
+	assert.Equal(t, denied+1, jwtValidations.values["denied"])
+}
+
+func TestMeteredStor(t *testing.T) {
+	ms := meteredStor{newStubStorClient()}
+
+	assert.NoError(t, ms.Write(context.Background(), []byte("key"), []byte("value")))
+	_, err := ms.Read(context.Background(), []byte("key"))
+	assert.NoError(t, err)
+	_, err = ms.Read(context.Background(), []byte("not_a_key"))
+	assert.Error(t, err)
+
+	assert.Equal(t, uint64(1), storDuration.histograms["write"].count)
+	assert.Equal(t, uint64(2), storDuration.histograms["read"].count)
+	assert.Equal(t, float64(1), storErrors.values["read"])
+	_, ok := storErrors.values["write"]
+	assert.False(t, ok, "successful writes should not be counted as error")
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	conn := new(stubConn)
+
+	handler(conn, redcon.Command{Args: [][]byte{[]byte("PING")}})
+	handler(conn, redcon.Command{Args: [][]byte{[]byte("ping")}})
+	handler(conn, redcon.Command{Args: [][]byte{[]byte("FOOBAR")}})
+
+	assert.True(t, cmdTotal.values["ping"] >= 2)
+	assert.True(t, cmdTotal.values["unknown"] >= 1)
+	assert.True(t, cmdDuration.histograms["ping"].count >= 2)
+	_, ok := cmdTotal.values["foobar"]
+	assert.False(t, ok, "unknown commands should not be used as label")
+}
+
+func TestSelfSignedCertDaysLeft(t *testing.T) {
+	ca, err := genCA()
+	assert.NoError(t, err)
+	cert, err := ca.issue(defaultHostnames)
+	assert.NoError(t, err)
+	certCache = cert
+	certCacheLock = new(sync.Mutex)
+
+	days, ok := selfSignedCertDaysLeft()
+	assert.True(t, ok)
+	assert.InDelta(t, certLifespan.Hours()/24, days, 1)
+}
+
+func TestACMECertDaysLeft(t *testing.T) {
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.ACME = true
+	setZConfig(&cfg)
+	defer func() { acmeLeaves = make(map[string]servedLeaf) }()
+
+	_, ok := certDaysLeft()
+	assert.False(t, ok, "no certificate served yet")
+
+	ca, err := genCA()
+	assert.NoError(t, err)
+	cert, err := ca.issue([]string{"a.example.com"})
+	assert.NoError(t, err)
+	soon, err := ca.issue([]string{"b.example.com"})
+	assert.NoError(t, err)
+	soon.Leaf.NotAfter = time.Now().Add(48 * time.Hour)
+	certs := map[string]*tls.Certificate{"a.example.com": cert, "b.example.com": soon}
+	getCertificate := recordACMELeaves(func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return certs[hello.ServerName], nil
+	})
+
+	getCertificate(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	days, ok := certDaysLeft()
+	assert.True(t, ok)
+	assert.InDelta(t, certLifespan.Hours()/24, days, 1)
+
+	// the certificate expiring first is reported
+	getCertificate(&tls.ClientHelloInfo{ServerName: "b.example.com"})
+	days, ok = certDaysLeft()
+	assert.True(t, ok)
+	assert.InDelta(t, 2, days, 0.1)
+
+	// certificates that weren't served recently are left out
+	acmeLeaves["b.example.com"] = servedLeaf{leaf: soon.Leaf, served: time.Now().Add(-2 * acmeLeafTTL)}
+	days, ok = certDaysLeft()
+	assert.True(t, ok)
+	assert.InDelta(t, certLifespan.Hours()/24, days, 1)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	metricsHandler(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, 200, rec.Code)
+	body := rec.Body.String()
+	for _, name := range []string{
+		"zedis_commands_total",
+		"zedis_command_duration_seconds",
+		"zedis_jwt_validations_total",
+		"zedis_stor_duration_seconds",
+		"zedis_stor_errors_total",
+		"zedis_connections_open",
+		"zedis_network_bytes_total",
+	} {
+		assert.True(t, strings.Contains(body, "# TYPE "+name+" "), "missing metric %s", name)
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+)
+
+const (
+	// amount of lines buffered for a monitor before lines get dropped
+	monitorBufferSize = 1024
+)
+
+var (
+	// connections in monitor mode
+	monitors     = make(map[*monitor]struct{})
+	monitorsLock = new(sync.RWMutex)
+)
+
+// monitor streams the processed commands to a detached connection
+type monitor struct {
+	conn     redcon.Conn
+	dc       redcon.DetachedConn
+	addr     string
+	listener string
+	lines    chan string
+	// amount of lines dropped because the client was too slow
+	dropped  int64
+	stopOnce sync.Once
+}
+
+// startMonitor detaches a connection and puts it in monitor mode
+func startMonitor(conn redcon.Conn) {
+	clearIdleTimeout(conn)
+	m := &monitor{
+		conn:     conn,
+		dc:       conn.Detach(),
+		addr:     remoteAddr(conn),
+		listener: getClient(conn).listener,
+		lines:    make(chan string, monitorBufferSize),
+	}
+	m.dc.WriteString("OK")
+	err := m.dc.Flush()
+	if err != nil {
+		// not monitoring yet, the closed callback cleans up the connection
+		m.dc.Close()
+		return
+	}
+	getClient(conn).monitoring = true
+
+	monitorsLock.Lock()
+	monitors[m] = struct{}{}
+	monitorsLock.Unlock()
+	log.Debugf("%s started monitoring", remoteAddr(conn))
+
+	go m.writeLines()
+	go m.readCommands()
+}
+
+// feedMonitors sends a processed command to all monitors
+// lines are dropped for monitors that can't keep up
+func feedMonitors(conn redcon.Conn, cmd redcon.Command) {
+	monitorsLock.RLock()
+	defer monitorsLock.RUnlock()
+	if len(monitors) == 0 {
+		return
+	}
+
+	line := monitorLine(time.Now(), getClient(conn).db, remoteAddr(conn), cmd)
+	for m := range monitors {
+		select {
+		case m.lines <- line:
+		default:
+			atomic.AddInt64(&m.dropped, 1)
+		}
+	}
+}
+
+// monitorLine formats a command the way Redis MONITOR does
+// e.g.: 1339518083.107412 [0 127.0.0.1:60866] "SET" "key" "value"
+func monitorLine(t time.Time, db int, addr string, cmd redcon.Command) string {
+	args := redactArgs(cmd.Args)
+
+	var b bytes.Buffer
+	b.WriteString(strconv.FormatInt(t.Unix(), 10))
+	b.WriteByte('.')
+	usec := strconv.Itoa(t.Nanosecond() / 1000)
+	b.WriteString(strings.Repeat("0", 6-len(usec)) + usec)
+	b.WriteString(" [")
+	b.WriteString(strconv.Itoa(db))
+	b.WriteByte(' ')
+	b.WriteString(addr)
+	b.WriteByte(']')
+	for _, arg := range args {
+		b.WriteByte(' ')
+		b.WriteString(strconv.Quote(string(arg)))
+	}
+	return b.String()
+}
+
+// writeLines writes the buffered lines to the monitor connection
+// until the monitor is stopped
+func (m *monitor) writeLines() {
+	defer m.disconnect()
+	for line := range m.lines {
+		m.dc.WriteString(line)
+		// write all lines that are ready before flushing
+		for pending := len(m.lines); pending > 0; pending-- {
+			line, ok := <-m.lines
+			if !ok {
+				break
+			}
+			m.dc.WriteString(line)
+		}
+		if dropped := atomic.SwapInt64(&m.dropped, 0); dropped > 0 {
+			m.dc.WriteString("(dropped " + strconv.FormatInt(dropped, 10) + " commands)")
+		}
+		err := m.dc.Flush()
+		if err != nil {
+			log.Debugf("failed to write to monitor %s: %v", m.addr, err)
+			m.stop()
+			return
+		}
+	}
+}
+
+// readCommands waits for the monitor to quit or disconnect
+// other commands are ignored while monitoring
+func (m *monitor) readCommands() {
+	for {
+		cmd, err := m.dc.ReadCommand()
+		if err != nil {
+			m.stop()
+			return
+		}
+		if strings.ToLower(string(cmd.Args[0])) == "quit" {
+			m.stop()
+			return
+		}
+	}
+}
+
+// stop removes the monitor from the monitors
+// the writer closes the connection once stopped
+func (m *monitor) stop() {
+	m.stopOnce.Do(func() {
+		monitorsLock.Lock()
+		delete(monitors, m)
+		monitorsLock.Unlock()
+		// no lines can be fed anymore once removed from the monitors
+		close(m.lines)
+	})
+}
+
+// disconnect closes the monitor connection
+func (m *monitor) disconnect() {
+	log.Debugf("%s stopped monitoring", m.addr)
+	m.dc.Close()
+	openConns.add(m.listener, -1)
+	removeClient(m.conn)
+}
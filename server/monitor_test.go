@@ -0,0 +1,81 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+)
+
+func TestMonitorLine(t *testing.T) {
+	ts := time.Unix(1339518083, 7412000)
+
+	line := monitorLine(ts, 0, "127.0.0.1:60866", redcon.Command{Args: [][]byte{
+		[]byte("SET"),
+		[]byte("key"),
+		[]byte("some \"value\"\n"),
+	}})
+	assert.Equal(t, `1339518083.007412 [0 127.0.0.1:60866] "SET" "key" "some \"value\"\n"`, line)
+
+	// JWTs are masked
+	line = monitorLine(ts, 2, "127.0.0.1:60866", redcon.Command{Args: [][]byte{
+		[]byte("auth"),
+		[]byte("aJWT"),
+	}})
+	assert.Equal(t, `1339518083.007412 [2 127.0.0.1:60866] "auth" "(redacted)"`, line)
+}
+
+func TestFeedMonitors(t *testing.T) {
+	assert := assert.New(t)
+	m := &monitor{lines: make(chan string, 2)}
+	monitorsLock.Lock()
+	monitors[m] = struct{}{}
+	monitorsLock.Unlock()
+
+	conn := new(stubConn)
+	cmd := redcon.Command{Args: [][]byte{[]byte("PING")}}
+	for i := 0; i < 5; i++ {
+		feedMonitors(conn, cmd)
+	}
+
+	// a slow monitor drops lines instead of blocking
+	assert.Len(m.lines, 2)
+	assert.Equal(int64(3), m.dropped)
+	assert.Contains(<-m.lines, `[0 127.0.0.1] "PING"`)
+
+	m.stop()
+	_, ok := monitors[m]
+	assert.False(ok, "stopped monitor should not be fed")
+	// stopping twice is safe
+	m.stop()
+	feedMonitors(conn, cmd)
+}
+
+func TestMonitorCmd(t *testing.T) {
+	permissionValidator = stubAuthValidator
+	conn := new(stubConn)
+	var cmd redcon.Command
+
+	// monitor always requires a JWT
+	cmd.Args = [][]byte{
+		[]byte("MONITOR"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, unAuthMsg, conn.s)
+
+	// invalid jwt
+	getClient(conn).jwt = "aJWT"
+	permissionValidator = stubAuthValidatorErr
+	dispatch(conn, cmd)
+	assert.Equal(t, "ERR JWT invalid: a stub error", conn.s)
+
+	// invalid command length
+	permissionValidator = stubAuthValidator
+	cmd.Args = [][]byte{
+		[]byte("MONITOR"),
+		[]byte("foo"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "ERR wrong number of arguments for 'MONITOR' command", conn.s)
+}
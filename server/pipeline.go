@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+)
+
+// maximum amount of commands of a pipeline processed at the same time
+var pipelineConcurrency = 64
+
+// pipelined returns true when a command starts a pipelined batch
+// of commands that can be processed concurrently
+func pipelined(conn redcon.Conn, cmd redcon.Command) bool {
+	next := conn.PeekPipeline()
+	if len(next) == 0 || !concurrent(cmd) || !concurrent(next[0]) {
+		return false
+	}
+	// MONITOR takes over the commands left in the pipeline when detaching
+	for _, cmd := range next {
+		if strings.EqualFold(string(cmd.Args[0]), "monitor") {
+			return false
+		}
+	}
+	return true
+}
+
+// concurrent returns true when a command can run concurrently with its neighbours
+func concurrent(cmd redcon.Command) bool {
+	c, ok := commands[strings.ToLower(string(cmd.Args[0]))]
+	return ok && c.concurrent
+}
+
+// servePipeline processes the commands of a pipeline
+// consecutive commands that can run concurrently are processed in parallel,
+// others are processed one by one, so writes keep their order
+func servePipeline(conn redcon.Conn, cmds []redcon.Command) {
+	for len(cmds) > 0 {
+		n := 0
+		for n < len(cmds) && concurrent(cmds[n]) {
+			n++
+		}
+		if n > 1 {
+			serveConcurrently(conn, cmds[:n])
+			cmds = cmds[n:]
+			continue
+		}
+
+		serveCommand(conn, cmds[0])
+		// commands after QUIT are not processed
+		if strings.EqualFold(string(cmds[0].Args[0]), "quit") {
+			return
+		}
+		cmds = cmds[1:]
+	}
+}
+
+// serveConcurrently processes commands in parallel
+// the replies are written in the order of the commands
+func serveConcurrently(conn redcon.Conn, cmds []redcon.Command) {
+	pcs := make([]*pipelinedConn, len(cmds))
+	handlers := make([]func(redcon.Conn, redcon.Command), len(cmds))
+	names := make([]string, len(cmds))
+
+	// authorization uses the state of the connection,
+	// so commands are prepared one by one
+	c := getClient(conn)
+	for i, cmd := range cmds {
+		pc := &pipelinedConn{Conn: conn, start: time.Now()}
+		c.resetTimings()
+		cmdEntry, ok := prepare(pc, cmd)
+		pc.jwtTime = c.jwtTime
+		if ok {
+			handlers[i] = cmdEntry.handler
+		}
+		names[i] = "unknown"
+		if cmdEntry != nil {
+			names[i] = cmdEntry.name
+		}
+		pcs[i] = pc
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, pipelineConcurrency)
+	for i, pc := range pcs {
+		if handlers[i] == nil {
+			pc.duration = time.Since(pc.start)
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(pc *pipelinedConn, handler func(redcon.Conn, redcon.Command), cmd redcon.Command) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			// the command timeout starts once the command gets its turn
+			pc.ctx, pc.cancel = newCommandContext()
+			handler(pc, cmd)
+			pc.cancel()
+			pc.duration = time.Since(pc.start)
+		}(pc, handlers[i], cmds[i])
+	}
+	wg.Wait()
+
+	for i, pc := range pcs {
+		conn.WriteRaw(pc.buf)
+		observeCommand(names[i], pc.duration, len(cmds[i].Raw), len(pc.buf))
+		c.recordCommand(names[i])
+		logIfSlow(pc, cmds[i], pc.start, pc.duration)
+		feedMonitors(conn, cmds[i])
+	}
+	extendIdleTimeout(conn)
+}
+
+// pipelinedConn buffers the reply of a command processed concurrently,
+// along with its timings
+type pipelinedConn struct {
+	redcon.Conn
+	buf      []byte
+	start    time.Time
+	duration time.Duration
+	// context of the command, with the command timeout, set once the command is processed
+	ctx    context.Context
+	cancel context.CancelFunc
+	// time spent in the 0-stor and validating JWTs
+	storTime time.Duration
+	jwtTime  time.Duration
+}
+
+func (pc *pipelinedConn) Context() interface{}     { return pc.ctx }
+func (pc *pipelinedConn) SetContext(v interface{}) { pc.ctx = v.(context.Context) }
+
+func (pc *pipelinedConn) WriteString(str string)      { pc.buf = redcon.AppendString(pc.buf, str) }
+func (pc *pipelinedConn) WriteBulk(bulk []byte)       { pc.buf = redcon.AppendBulk(pc.buf, bulk) }
+func (pc *pipelinedConn) WriteBulkString(bulk string) { pc.buf = redcon.AppendBulkString(pc.buf, bulk) }
+func (pc *pipelinedConn) WriteInt(num int)            { pc.buf = redcon.AppendInt(pc.buf, int64(num)) }
+func (pc *pipelinedConn) WriteInt64(num int64)        { pc.buf = redcon.AppendInt(pc.buf, num) }
+func (pc *pipelinedConn) WriteUint64(num uint64)      { pc.buf = redcon.AppendUint(pc.buf, num) }
+func (pc *pipelinedConn) WriteError(msg string)       { pc.buf = redcon.AppendError(pc.buf, msg) }
+func (pc *pipelinedConn) WriteArray(count int)        { pc.buf = redcon.AppendArray(pc.buf, count) }
+func (pc *pipelinedConn) WriteNull()                  { pc.buf = redcon.AppendNull(pc.buf) }
+func (pc *pipelinedConn) WriteRaw(data []byte)        { pc.buf = append(pc.buf, data...) }
+func (pc *pipelinedConn) WriteAny(v interface{})      { pc.buf = redcon.AppendAny(pc.buf, v) }
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/stor"
+)
+
+func TestPipelined(t *testing.T) {
+	assert := assert.New(t)
+	get := redcon.Command{Args: [][]byte{[]byte("GET"), []byte("a")}}
+	set := redcon.Command{Args: [][]byte{[]byte("SET"), []byte("a"), []byte("b")}}
+	monitor := redcon.Command{Args: [][]byte{[]byte("MONITOR")}}
+
+	conn := new(stubConn)
+	assert.False(pipelined(conn, get), "single command")
+
+	conn.cmds = []redcon.Command{get}
+	assert.True(pipelined(conn, get))
+	assert.False(pipelined(conn, set), "command that writes")
+
+	conn.cmds = []redcon.Command{set, get}
+	assert.False(pipelined(conn, get), "next command writes")
+
+	conn.cmds = []redcon.Command{get, monitor}
+	assert.False(pipelined(conn, get), "MONITOR takes over the pipeline")
+}
+
+func TestServePipeline(t *testing.T) {
+	assert := assert.New(t)
+	permissionValidator = stubAuthValidator
+	storClient = newStubStorClient()
+	storClient.Write(context.Background(), []byte("hello"), []byte("world"))
+
+	conn := new(recordConn)
+	getClient(conn).jwt = "aJWT"
+	defer removeClient(conn)
+	conn.cmds = []redcon.Command{
+		{Args: [][]byte{[]byte("GET"), []byte("missing")}},
+		{Args: [][]byte{[]byte("SET"), []byte("hello"), []byte("there")}},
+		{Args: [][]byte{[]byte("GET"), []byte("hello")}},
+		{Args: [][]byte{[]byte("EXISTS"), []byte("hello"), []byte("missing")}},
+		{Args: [][]byte{[]byte("GET")}},
+		{Args: [][]byte{[]byte("QUIT")}},
+		{Args: [][]byte{[]byte("GET"), []byte("hello")}},
+	}
+
+	handler(conn, redcon.Command{Args: [][]byte{[]byte("GET"), []byte("hello")}})
+	assert.Equal([]string{
+		"$5\r\nworld\r\n",
+		"-ERR reading from the stor: key was not found\r\n",
+		"OK",
+		"$5\r\nthere\r\n",
+		":1\r\n",
+		"-ERR wrong number of arguments for 'GET' command\r\n",
+		"OK",
+	}, conn.replies, "replies are written in order, commands after QUIT are not processed")
+	assert.True(conn.closed)
+	assert.Empty(conn.cmds)
+}
+
+func TestServeConcurrently(t *testing.T) {
+	assert := assert.New(t)
+	permissionValidator = stubAuthValidator
+	sc := &blockingStorClient{
+		stubStorClient: newStubStorClient(),
+		inFlight:       3,
+		release:        make(chan struct{}),
+	}
+	sc.Write(context.Background(), []byte("a"), []byte("1"))
+	sc.Write(context.Background(), []byte("b"), []byte("2"))
+	sc.Write(context.Background(), []byte("c"), []byte("3"))
+	storClient = sc
+
+	conn := new(recordConn)
+	getClient(conn).jwt = "aJWT"
+	defer removeClient(conn)
+	conn.cmds = []redcon.Command{
+		{Args: [][]byte{[]byte("GET"), []byte("b")}},
+		{Args: [][]byte{[]byte("GET"), []byte("c")}},
+	}
+
+	// the reads only return once all of them are in flight
+	handler(conn, redcon.Command{Args: [][]byte{[]byte("GET"), []byte("a")}})
+	assert.Equal([]string{"$1\r\n1\r\n", "$1\r\n2\r\n", "$1\r\n3\r\n"}, conn.replies)
+}
+
+func TestServeConcurrentlyCommandTimeout(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.CommandTimeout = 100
+	setZConfig(&cfg)
+	defer func(concurrency int) { pipelineConcurrency = concurrency }(pipelineConcurrency)
+	pipelineConcurrency = 1
+
+	permissionValidator = stubAuthValidator
+	sc := &slowStorClient{stubStorClient: newStubStorClient(), delay: 40 * time.Millisecond}
+	sc.Write(context.Background(), []byte("a"), []byte("1"))
+	storClient = sc
+
+	conn := new(recordConn)
+	getClient(conn).jwt = "aJWT"
+	defer removeClient(conn)
+	conn.cmds = []redcon.Command{
+		{Args: [][]byte{[]byte("GET"), []byte("a")}},
+		{Args: [][]byte{[]byte("GET"), []byte("a")}},
+		{Args: [][]byte{[]byte("GET"), []byte("a")}},
+	}
+
+	// the command timeout starts once a command is processed, not while it waits for its turn
+	handler(conn, redcon.Command{Args: [][]byte{[]byte("GET"), []byte("a")}})
+	assert.Equal([]string{"$1\r\n1\r\n", "$1\r\n1\r\n", "$1\r\n1\r\n", "$1\r\n1\r\n"}, conn.replies)
+}
+
+// slowStorClient takes a while to read, unless the context is done first
+type slowStorClient struct {
+	*stubStorClient
+	delay time.Duration
+}
+
+func (c *slowStorClient) Read(ctx context.Context, key []byte) ([]byte, error) {
+	select {
+	case <-time.After(c.delay):
+		return c.stubStorClient.Read(ctx, key)
+	case <-ctx.Done():
+		return nil, stor.ErrTimeout
+	}
+}
+
+// blockingStorClient blocks reads until the expected amount of reads are in flight
+type blockingStorClient struct {
+	*stubStorClient
+	inFlight int
+	release  chan struct{}
+	lock     sync.Mutex
+}
+
+func (c *blockingStorClient) Read(ctx context.Context, key []byte) ([]byte, error) {
+	c.lock.Lock()
+	c.inFlight--
+	if c.inFlight == 0 {
+		close(c.release)
+	}
+	c.lock.Unlock()
+
+	select {
+	case <-c.release:
+		return c.stubStorClient.Read(ctx, key)
+	case <-time.After(time.Second):
+		return nil, errors.New("reads were not processed concurrently")
+	}
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+)
+
+// time a load balancer gets to send the PROXY protocol header of a new connection
+var proxyHeaderTimeout = 2 * time.Second
+
+const (
+	// maximum length of a PROXY protocol v1 header, including the CRLF
+	proxyV1MaxLen = 107
+	// length of the fixed part of a PROXY protocol v2 header
+	proxyV2HeaderLen = 16
+)
+
+// signature starting a PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errNoProxyHeader = errors.New("no PROXY protocol header")
+
+// proxyListener accepts connections from a load balancer sending the PROXY protocol
+type proxyListener struct {
+	net.Listener
+}
+
+// Accept implements net.Listener.Accept
+// the header isn't read yet, so a silent connection doesn't hold up accepting others
+func (l proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn}, nil
+}
+
+// proxyConn reads the PROXY protocol header of a connection on its first Read,
+// which happens on the goroutine serving the connection
+type proxyConn struct {
+	net.Conn
+	once sync.Once
+	err  error
+	// read deadline set by the server, restored after reading the header
+	readDeadline time.Time
+	// called with the addresses of the header, nil when the load balancer doesn't proxy a client
+	// the connection is closed when it returns an error
+	onHeader func(src, dst *net.TCPAddr) error
+}
+
+// Read implements net.Conn.Read
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.Conn.Read(b)
+}
+
+// SetDeadline implements net.Conn.SetDeadline
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.readDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.SetReadDeadline
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *proxyConn) readHeader() {
+	deadline := time.Now().Add(proxyHeaderTimeout)
+	if !c.readDeadline.IsZero() && c.readDeadline.Before(deadline) {
+		deadline = c.readDeadline
+	}
+	c.err = c.Conn.SetReadDeadline(deadline)
+	if c.err != nil {
+		return
+	}
+	var src, dst *net.TCPAddr
+	src, dst, c.err = parseProxyHeader(c.Conn)
+	if c.err != nil {
+		c.err = fmt.Errorf("invalid PROXY protocol header: %v", c.err)
+		return
+	}
+	if c.onHeader != nil {
+		c.err = c.onHeader(src, dst)
+		if c.err != nil {
+			return
+		}
+	}
+	c.err = c.Conn.SetReadDeadline(c.readDeadline)
+}
+
+// getProxyConn returns the connection from a load balancer underlying a redcon connection, if any
+func getProxyConn(conn redcon.Conn) *proxyConn {
+	netConn := conn.NetConn()
+	// the header precedes the TLS handshake
+	if tlsConn, ok := netConn.(*tls.Conn); ok {
+		netConn = tlsConn.NetConn()
+	}
+	pc, _ := netConn.(*proxyConn)
+	return pc
+}
+
+// parseProxyHeader reads a PROXY protocol v1 or v2 header,
+// without reading any bytes following it
+// nil addresses are returned when the header doesn't proxy a TCP client
+func parseProxyHeader(r io.Reader) (src, dst *net.TCPAddr, err error) {
+	// the shortest v1 header ("PROXY UNKNOWN\r\n") is longer than the v2 signature
+	start := make([]byte, len(proxyV2Signature))
+	_, err = io.ReadFull(r, start)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case bytes.Equal(start, proxyV2Signature):
+		return parseProxyV2(r)
+	case bytes.HasPrefix(start, []byte("PROXY ")):
+		return parseProxyV1(r, start)
+	}
+	return nil, nil, errNoProxyHeader
+}
+
+// parseProxyV1 reads the rest of a human readable v1 header, e.g.:
+// PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func parseProxyV1(r io.Reader, start []byte) (src, dst *net.TCPAddr, err error) {
+	line := start
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLen {
+			return nil, nil, errors.New("PROXY protocol v1 header too long")
+		}
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b[0])
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v1 header %q", line)
+	}
+	src, err = proxyV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err = proxyV1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+// proxyV1Addr parses an address of a v1 header
+func proxyV1Addr(ip, port string) (*net.TCPAddr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil {
+		return nil, fmt.Errorf("invalid IP address %q in PROXY protocol header", ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q in PROXY protocol header", port)
+	}
+	addr.Port = int(p)
+	return addr, nil
+}
+
+// parseProxyV2 reads the rest of a binary v2 header
+func parseProxyV2(r io.Reader) (src, dst *net.TCPAddr, err error) {
+	header := make([]byte, proxyV2HeaderLen-len(proxyV2Signature))
+	_, err = io.ReadFull(r, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	version, command, family := header[0]>>4, header[0]&0xF, header[1]
+	if version != 2 {
+		return nil, nil, fmt.Errorf("unsupported PROXY protocol version %d", version)
+	}
+	// the addresses are followed by optional TLVs, which are ignored
+	payload := make([]byte, binary.BigEndian.Uint16(header[2:]))
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch command {
+	case 0x0:
+		// LOCAL: connection of the load balancer itself
+		return nil, nil, nil
+	case 0x1:
+		// PROXY
+	default:
+		return nil, nil, fmt.Errorf("unsupported PROXY protocol command %d", command)
+	}
+
+	var ipLen int
+	switch family {
+	case 0x11:
+		// TCP over IPv4
+		ipLen = net.IPv4len
+	case 0x21:
+		// TCP over IPv6
+		ipLen = net.IPv6len
+	default:
+		// UDP, Unix sockets and unspecified
+		return nil, nil, nil
+	}
+	if len(payload) < 2*ipLen+4 {
+		return nil, nil, errors.New("PROXY protocol v2 addresses too short")
+	}
+	src = &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	dst = &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+	return src, dst, nil
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-os/zedis/config"
+)
+
+func TestParseProxyHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	v2 := func(command, family byte, addrs []byte) []byte {
+		header := append([]byte{}, proxyV2Signature...)
+		header = append(header, 0x20|command, family, 0, 0)
+		binary.BigEndian.PutUint16(header[14:], uint16(len(addrs)))
+		return append(header, addrs...)
+	}
+	tcp4 := []byte{192, 0, 2, 1, 192, 0, 2, 2, 0xDC, 0x04, 0x18, 0xEB}
+
+	valid := []struct {
+		header   []byte
+		src, dst string
+	}{
+		{[]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 6379\r\n"), "192.0.2.1:56324", "192.0.2.2:6379"},
+		{[]byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 6379\r\n"), "[2001:db8::1]:56324", "[2001:db8::2]:6379"},
+		{v2(0x1, 0x11, tcp4), "192.0.2.1:56324", "192.0.2.2:6379"},
+		{v2(0x1, 0x11, append(tcp4, 0x04, 0, 1, 0)), "192.0.2.1:56324", "192.0.2.2:6379"},
+	}
+	for _, tc := range valid {
+		r := bytes.NewReader(append(tc.header, "PING\r\n"...))
+		src, dst, err := parseProxyHeader(r)
+		if assert.NoError(err, string(tc.header)) {
+			assert.Equal(tc.src, src.String())
+			assert.Equal(tc.dst, dst.String())
+		}
+		rest, _ := ioutil.ReadAll(r)
+		assert.Equal("PING\r\n", string(rest), "bytes after the header are not read")
+	}
+
+	// not proxying a client
+	for _, header := range [][]byte{
+		[]byte("PROXY UNKNOWN\r\n"),
+		[]byte("PROXY UNKNOWN 192.0.2.1 192.0.2.2 56324 6379\r\n"),
+		v2(0x0, 0x00, nil),
+		v2(0x1, 0x00, nil),
+	} {
+		src, dst, err := parseProxyHeader(bytes.NewReader(header))
+		assert.NoError(err, string(header))
+		assert.Nil(src)
+		assert.Nil(dst)
+	}
+
+	for _, header := range [][]byte{
+		[]byte("PING\r\n"),
+		[]byte("*1\r\n$4\r\nPING\r\n"),
+		[]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324\r\n"),
+		[]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 65536\r\n"),
+		[]byte("PROXY TCP4 hostname 192.0.2.2 56324 6379\r\n"),
+		[]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 6379"),
+		append([]byte("PROXY "), bytes.Repeat([]byte("A"), 200)...),
+		v2(0x2, 0x11, tcp4),
+		v2(0x1, 0x11, tcp4[:8]),
+		v2(0x1, 0x11, tcp4)[:20],
+	} {
+		_, _, err := parseProxyHeader(bytes.NewReader(header))
+		assert.Error(err, string(header))
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis-proxy")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "zedis.sock")
+
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.Listeners = []config.Listener{{Name: "lb", Network: "unix", Address: path, ProxyProtocol: true}}
+	setZConfig(&cfg)
+	go listenAndServe(cfg.Listeners[0], nil)
+
+	var conn net.Conn
+	for i := 0; i < 100; i++ {
+		conn, err = net.Dial("unix", path)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 6379\r\nPING\r\n"))
+	assert.NoError(err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("+PONG\r\n", line)
+
+	var proxied *clientInfo
+	for _, info := range listClients() {
+		if info.listener == "lb" {
+			proxied = &info
+		}
+	}
+	if assert.NotNil(proxied) {
+		assert.Equal("192.0.2.1:56324", proxied.addr)
+		assert.Equal("192.0.2.2:6379", proxied.laddr)
+		assert.Equal("ping", proxied.cmd)
+	}
+
+	// connections without a header are refused
+	plain, err := net.Dial("unix", path)
+	if !assert.NoError(err) {
+		return
+	}
+	defer plain.Close()
+	_, err = plain.Write([]byte("PING\r\n\r\n\r\n"))
+	assert.NoError(err)
+	plain.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = bufio.NewReader(plain).ReadString('\n')
+	assert.Error(err)
+}
+
+func TestProxyProtocolSilentConnection(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis-proxy")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "zedis.sock")
+
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.Listeners = []config.Listener{{Name: "lb", Network: "unix", Address: path, ProxyProtocol: true}}
+	setZConfig(&cfg)
+	go listenAndServe(cfg.Listeners[0], nil)
+
+	var silent net.Conn
+	for i := 0; i < 100; i++ {
+		silent, err = net.Dial("unix", path)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !assert.NoError(err) {
+		return
+	}
+	defer silent.Close()
+
+	// a connection that doesn't send its header doesn't hold up others until it times out
+	conn, err := net.Dial("unix", path)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 6379\r\nPING\r\n"))
+	assert.NoError(err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("+PONG\r\n", line)
+}
@@ -1,61 +1,142 @@
 package server
 
 import (
-	"strings"
-	"sync"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/tidwall/redcon"
 	"github.com/zero-os/zedis/config"
+	"github.com/zero-os/zedis/server/jwt"
 	"github.com/zero-os/zedis/stor"
 )
 
 var (
-	zConfig    *config.Zedis
+	// config of the running server, swapped as a whole when reloaded
+	currentConfig atomic.Value
+	// stor client of database 0
 	storClient stor.Client
-
-	// saves the jwt for a connection
-	connsJWT     map[redcon.Conn]string
-	connsJWTLock *sync.Mutex
+	// stor clients of the configured databases, by index
+	dbStorClients = make(map[int]stor.Client)
 )
 
+// time given to write the error to a rejected connection
+const rejectTimeout = time.Second
+
 // ListenAndServeRedis runs the redis server
 func ListenAndServeRedis(cfg *config.Zedis) error {
-	zConfig = cfg
-	var err error
-	storClient, err = stor.NewStor(zConfig.StorPolicy())
+	setZConfig(cfg)
+	err := validateListenerCommands(cfg)
+	if err != nil {
+		return err
+	}
+	client, err := stor.NewStor(cfg.StorPolicy())
 	if err != nil {
 		return err
 	}
+	storClient = meteredStor{client}
+	for _, db := range cfg.Databases {
+		client, err := stor.NewStor(cfg.DatabaseStorPolicy(db))
+		if err != nil {
+			return fmt.Errorf("failed to create stor client for database %d: %v", db.Index, err)
+		}
+		dbStorClients[db.Index] = meteredStor{client}
+	}
+	err = configureJWTIssuers(cfg.JWTIssuers)
+	if err != nil {
+		return err
+	}
+	permissionValidator = meteredValidator(jwt.ValidatePermission)
 
-	connsJWT = make(map[redcon.Conn]string)
-	connsJWTLock = &sync.Mutex{}
+	slowLog = newSlowlog(cfg.SlowlogMaxLen)
 
-	var errChannel chan error
+	// the revocation file is created by the first revocation when it doesn't exist yet
+	if cfg.RevocationFile != "" {
+		err = loadRevocations(cfg.RevocationFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to load revocation file: %v", err)
+		}
+	}
 
-	// serve Redis over plain TCP
-	if zConfig.Port != "" {
+	// the ACL file is created by ACL SAVE when it doesn't exist yet
+	if cfg.ACLFile != "" {
+		err = loadACLFile(cfg.ACLFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to load ACL file: %v", err)
+		}
+	}
+
+	go reloadOnSIGHUP()
+
+	errChannel := make(chan error)
+
+	// serve Prometheus metrics over HTTP
+	if cfg.MetricsAddr != "" {
 		go func() {
-			log.Infof("Redis plain TCP interface listening at localhost%s", zConfig.Port)
-			defer log.Info("Redis plain TCP interface closed")
+			log.Infof("Metrics HTTP interface listening at %s", cfg.MetricsAddr)
+			defer log.Info("Metrics HTTP interface closed")
 
-			errChannel <- redcon.ListenAndServe(zConfig.Port, handler, accept, closed)
+			errChannel <- listenAndServeMetrics(cfg.MetricsAddr)
 		}()
 	}
 
-	go func() {
-		// serve Redis over TCP with TLS
-		tlsCfg, err := tlsConfig(zConfig)
+	// TLS is configured once, for the TLS port and the TLS listeners
+	var tlsCfg *tls.Config
+	if needsTLS(cfg) {
+		tlsCfg, err = tlsConfig(cfg)
 		if err != nil {
-			errChannel <- err
-			return
+			return err
 		}
+	}
+
+	// answer ACME HTTP-01 challenges
+	if acmeCertManager != nil && cfg.ACMEHTTPAddr != "" {
+		go func() {
+			log.Infof("ACME HTTP interface listening at %s", cfg.ACMEHTTPAddr)
+			defer log.Info("ACME HTTP interface closed")
+
+			errChannel <- listenAndServeACMEHTTP(cfg.ACMEHTTPAddr, acmeCertManager)
+		}()
+	}
+
+	// serve Redis over plain TCP
+	if cfg.Port != "" {
+		go func() {
+			log.Infof("Redis plain TCP interface listening at localhost%s", cfg.Port)
+			defer log.Info("Redis plain TCP interface closed")
+
+			errChannel <- redcon.ListenAndServe(cfg.Port, handler, accept("plain"), closed("plain"))
+		}()
+	}
+
+	// serve Redis over TCP with TLS
+	if cfg.TLSPort != "" {
+		go func() {
+			log.Infof("Redis TLS interface listening at localhost%s", cfg.TLSPort)
+			defer log.Info("Redis TLS interface closed")
+
+			errChannel <- redcon.ListenAndServeTLS(cfg.TLSPort, handler, accept("tls"), closed("tls"), tlsCfg)
+		}()
+	}
 
-		log.Infof("Redis TLS interface listening at localhost%s", zConfig.TLSPort)
-		defer log.Info("Redis TLS interface closed")
+	// serve Redis over a Unix socket
+	if cfg.UnixSocket != "" {
+		go func() {
+			errChannel <- listenAndServeUnix("unix", cfg.UnixSocket, cfg.UnixSocketPermMode)
+		}()
+	}
 
-		errChannel <- redcon.ListenAndServeTLS(zConfig.TLSPort, handler, accept, closed, tlsCfg)
-	}()
+	// serve Redis on the configured listeners
+	for _, l := range cfg.Listeners {
+		go func(l config.Listener) {
+			errChannel <- listenAndServe(l, tlsCfg)
+		}(l)
+	}
 
 	// return if context is done or error
 	// TODO: (gracefully) close still running servers (https://github.com/zero-os/zedis/issues/1)
@@ -65,35 +146,150 @@ func ListenAndServeRedis(cfg *config.Zedis) error {
 	}
 }
 
+// zConfig returns the config of the running server
+func zConfig() *config.Zedis {
+	return currentConfig.Load().(*config.Zedis)
+}
+
+// setZConfig replaces the config of the running server
+func setZConfig(cfg *config.Zedis) {
+	currentConfig.Store(cfg)
+}
+
 // redcon plain tcp handler func
 func handler(conn redcon.Conn, cmd redcon.Command) {
-	switch strings.ToLower(string(cmd.Args[0])) {
-	case "ping":
-		ping(conn)
-	case "quit":
-		quit(conn)
-	case "auth":
-		auth(conn, cmd)
-	case "set":
-		set(conn, cmd)
-	case "get":
-		get(conn, cmd)
-	case "exists":
-		exists(conn, cmd)
-	default:
-		unknown(conn, cmd)
+	if pipelined(conn, cmd) {
+		servePipeline(conn, append([]redcon.Command{cmd}, conn.ReadPipeline()...))
+		return
+	}
+	serveCommand(conn, cmd)
+}
+
+// serveCommand processes a single command
+func serveCommand(conn redcon.Conn, cmd redcon.Command) {
+	start := time.Now()
+	// size of the reply buffer before handling the command
+	// used to measure the amount of bytes written to the connection
+	var bufLen int
+	wr := redcon.BaseWriter(conn)
+	if wr != nil {
+		bufLen = len(wr.Buffer())
+	}
+
+	getClient(conn).resetTimings()
+
+	ctx, cancel := newCommandContext()
+	conn.SetContext(ctx)
+	name := dispatch(conn, cmd)
+	cancel()
+
+	var bytesOut int
+	if wr != nil {
+		// the buffer gets flushed when the connection was closed,
+		// those bytes are not counted
+		bytesOut = len(wr.Buffer()) - bufLen
+	}
+	duration := time.Since(start)
+	observeCommand(name, duration, len(cmd.Raw), bytesOut)
+	getClient(conn).recordCommand(name)
+	logIfSlow(conn, cmd, start, duration)
+	// monitoring connections don't time out
+	if name != "monitor" {
+		feedMonitors(conn, cmd)
+		extendIdleTimeout(conn)
+	}
+}
+
+// accept returns the redcon accept func for a listener
+func accept(listener string) func(conn redcon.Conn) bool {
+	return func(conn redcon.Conn) bool {
+		getClient(conn).listener = listener
+		if pc := getProxyConn(conn); pc != nil {
+			// the client is admitted once the load balancer sent its address
+			pc.onHeader = func(src, dst *net.TCPAddr) error {
+				return admitProxied(conn, pc, src, dst)
+			}
+		} else if reply := admit(conn); reply != "" {
+			return reject(conn, reply)
+		}
+		if netConn := conn.NetConn(); netConn != nil {
+			err := setKeepAlive(netConn, time.Duration(zConfig().TCPKeepAlive)*time.Second)
+			if err != nil {
+				log.Debugf("failed to set TCP keepalive of %s: %v", remoteAddr(conn), err)
+			}
+		}
+		extendIdleTimeout(conn)
+		openConns.add(listener, 1)
+		return true
 	}
 }
 
-// redcon accept func
-func accept(conn redcon.Conn) bool {
-	log.Debugf("Received connection from %s", conn.RemoteAddr())
-	return true
+// admit checks if a connection is allowed and counts it for the client limits
+// the error reply refusing the connection is returned when it isn't
+func admit(conn redcon.Conn) string {
+	log.Debugf("Received connection from %s", remoteAddr(conn))
+	err := checkAccess(getClient(conn).listener, remoteHost(remoteAddr(conn)))
+	if err == errProtectedMode {
+		return "DENIED " + err.Error()
+	}
+	if err == nil {
+		err = admitClient(conn)
+	}
+	if err != nil {
+		return "ERR " + err.Error()
+	}
+	registerClient(conn)
+	return ""
 }
 
-// redcon closed func
-func closed(conn redcon.Conn, err error) {
-	connsJWTLock.Lock()
-	defer connsJWTLock.Unlock()
-	delete(connsJWT, conn)
+// admitProxied admits a connection from a load balancer once it sent the addresses of the client,
+// which are nil when it doesn't proxy a client (e.g. for health checks)
+// the connection is closed when an error is returned
+func admitProxied(conn redcon.Conn, pc *proxyConn, src, dst *net.TCPAddr) error {
+	if src != nil {
+		getClient(conn).setAddrs(src.String(), dst.String())
+	}
+	reply := admit(conn)
+	if reply == "" {
+		return nil
+	}
+	log.Debugf("Rejected connection from %s: %s", remoteAddr(conn), reply)
+	// the reply can't precede the TLS handshake
+	if conn.NetConn() == pc {
+		pc.Conn.SetWriteDeadline(time.Now().Add(rejectTimeout))
+		pc.Conn.Write(redcon.AppendError(nil, reply))
+	}
+	return errors.New(reply)
+}
+
+// reject refuses a connection, with an error reply on plaintext connections
+// redcon flushes the connection when closing it from the accept loop
+func reject(conn redcon.Conn, reply string) bool {
+	log.Debugf("Rejected connection from %s: %s", remoteAddr(conn), reply)
+	netConn := conn.NetConn()
+	if _, ok := netConn.(*tls.Conn); ok {
+		// the flush runs the TLS handshake, which would wait for the client,
+		// with the deadline passed it fails before reading or writing anything
+		netConn.SetDeadline(time.Now())
+	} else {
+		// the reply fits in the buffer of a new socket, the deadline is a safeguard
+		if netConn != nil {
+			netConn.SetDeadline(time.Now().Add(rejectTimeout))
+		}
+		conn.WriteError(reply)
+	}
+	removeClient(conn)
+	return false
+}
+
+// closed returns the redcon closed func for a listener
+func closed(listener string) func(conn redcon.Conn, err error) {
+	return func(conn redcon.Conn, err error) {
+		// detached monitor connections stay open
+		if getClient(conn).monitoring {
+			return
+		}
+		openConns.add(listener, -1)
+		removeClient(conn)
+	}
 }
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/config"
+	"github.com/zero-os/zedis/server/jwt"
+)
+
+// config fields that are applied to the running server, by YAML name
+// changes of the other fields only take effect after a restart
+var liveConfigFields = map[string]bool{
+	"auth_commands":             true,
+	"unix_socket_auth_commands": true,
+	"auth_policy":               true,
+	"acl_file":                  true,
+	"slowlog_log_slower_than":   true,
+	"slowlog_max_len":           true,
+	"maxclients":                true,
+	"maxclients_per_ip":         true,
+	"rate_limits":               true,
+	"timeout":                   true,
+	"tcp_keepalive":             true,
+	"command_timeout":           true,
+	"protected_mode":            true,
+	"jwt_organization":          true,
+	"jwt_namespace":             true,
+	"jwt_issuers":               true,
+	"revocation_file":           true,
+	"acme_whitelist":            true,
+}
+
+// serializes changes to the running config
+var configLock sync.Mutex
+
+// reloadConfig reloads the config file of the running config and applies the fields that can change live
+// the running config is untouched when the new config is invalid
+// returns the YAML names of the changed fields that need a restart
+func reloadConfig() ([]string, error) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	current := zConfig()
+	next, err := config.NewZedisConfigFromFile(current.Path, current.Overrides...)
+	if err != nil {
+		return nil, err
+	}
+
+	var live, restart []string
+	for _, field := range config.ChangedFields(current, next) {
+		if liveConfigFields[field] {
+			live = append(live, field)
+		} else {
+			restart = append(restart, field)
+		}
+	}
+
+	err = applyConfig(current, next, live)
+	if err != nil {
+		return nil, err
+	}
+	return restart, nil
+}
+
+// applyConfig makes the running server use the given fields of the next config
+// the running config is untouched when one of them can't be applied
+func applyConfig(current, next *config.Zedis, fields []string) error {
+	applied := *current
+	config.CopyFields(&applied, next, fields)
+
+	// everything that can fail is done before anything is applied
+	var issuers []jwt.Issuer
+	issuersChanged := changed(fields, "jwt_issuers")
+	if issuersChanged && len(applied.JWTIssuers) > 0 {
+		var err error
+		issuers, err = jwtIssuers(applied.JWTIssuers)
+		if err != nil {
+			return err
+		}
+	}
+	if changed(fields, "revocation_file") && applied.RevocationFile != "" {
+		err := loadRevocations(applied.RevocationFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if issuersChanged {
+		var err error
+		if len(issuers) == 0 {
+			err = jwt.SetDefaultIssuer()
+		} else {
+			err = jwt.SetIssuers(issuers)
+		}
+		if err != nil {
+			log.Errorf("failed to apply jwt_issuers: %v", err)
+		}
+	}
+	if applied.SlowlogMaxLen != current.SlowlogMaxLen {
+		slowLog.resize(applied.SlowlogMaxLen)
+	}
+
+	setZConfig(&applied)
+	if len(fields) > 0 {
+		log.Infof("Applied config changes: %s", strings.Join(fields, ", "))
+	}
+	return nil
+}
+
+func changed(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadOnSIGHUP reloads the config file when the process receives SIGHUP
+func reloadOnSIGHUP() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		log.Infof("Received SIGHUP, reloading config file %s", zConfig().Path)
+		logReload(reloadConfig())
+	}
+}
+
+func logReload(restart []string, err error) {
+	if err != nil {
+		log.Errorf("failed to reload config, keeping the running config: %v", err)
+		return
+	}
+	if len(restart) > 0 {
+		log.Warnf("Config changes that need a restart to take effect: %s", strings.Join(restart, ", "))
+	}
+}
+
+func configCmd(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received CONFIG command from %s", remoteAddr(conn))
+
+	args := cmd.Args[2:]
+	switch strings.ToUpper(string(cmd.Args[1])) {
+	case "GET":
+		if len(args) == 0 {
+			wrongArgCount(conn, cmd)
+			return
+		}
+		configGet(conn, args)
+	case "SET":
+		if len(args) == 0 || len(args)%2 != 0 {
+			wrongArgCount(conn, cmd)
+			return
+		}
+		configSet(conn, args)
+	case "REWRITE":
+		if len(args) != 0 {
+			wrongArgCount(conn, cmd)
+			return
+		}
+		err := rewriteConfig()
+		if err != nil {
+			conn.WriteError("ERR Rewriting config file: " + err.Error())
+			return
+		}
+		conn.WriteString("OK")
+	case "RELOAD":
+		if len(args) != 0 {
+			wrongArgCount(conn, cmd)
+			return
+		}
+		restart, err := reloadConfig()
+		logReload(restart, err)
+		if err != nil {
+			conn.WriteError("ERR " + err.Error())
+			return
+		}
+		conn.WriteString("OK")
+	default:
+		conn.WriteError("ERR unknown subcommand '" + string(cmd.Args[1]) + "'. Try CONFIG GET, SET, REWRITE or RELOAD.")
+	}
+}
+
+// configGet replies the names and values of the config fields matching one of the patterns
+// secrets are never replied
+func configGet(conn redcon.Conn, patterns [][]byte) {
+	cfg := zConfig()
+	var reply []string
+	for _, name := range config.FieldNames() {
+		for _, pattern := range patterns {
+			if !matchPattern(strings.ToLower(string(pattern)), name) {
+				continue
+			}
+			if value, ok := config.FieldValue(cfg, name); ok {
+				reply = append(reply, name, value)
+			}
+			break
+		}
+	}
+
+	conn.WriteArray(len(reply))
+	for _, s := range reply {
+		conn.WriteBulkString(s)
+	}
+}
+
+// configSet applies config fields to the running server
+// all fields are applied or, when one of them is invalid or can't change live, none
+func configSet(conn redcon.Conn, args [][]byte) {
+	values := make(map[string]string, len(args)/2)
+	names := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(string(args[i]))
+		if !config.HasField(name) {
+			conn.WriteError("ERR Unknown option '" + name + "'")
+			return
+		}
+		if !liveConfigFields[name] {
+			conn.WriteError("ERR '" + name + "' can't be changed on a running server, change it in the config file and restart")
+			return
+		}
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = string(args[i+1])
+	}
+
+	configLock.Lock()
+	defer configLock.Unlock()
+	current := zConfig()
+	next, err := config.SetFields(current, values)
+	if err != nil {
+		conn.WriteError("ERR Invalid argument: " + err.Error())
+		return
+	}
+	err = applyConfig(current, next, names)
+	if err != nil {
+		conn.WriteError("ERR " + err.Error())
+		return
+	}
+	conn.WriteString("OK")
+}
+
+// rewriteConfig writes the fields of the running config that differ from the config file to that file
+func rewriteConfig() error {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	current := zConfig()
+	if current.Path == "" {
+		return errors.New("the server is running without a config file")
+	}
+	saved, err := config.NewZedisConfigFromFile(current.Path, current.Overrides...)
+	if err != nil {
+		return err
+	}
+
+	// only live fields can differ, other changes to the file are kept
+	var fields []string
+	for _, field := range config.ChangedFields(saved, current) {
+		if liveConfigFields[field] {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	err = config.RewriteFile(current.Path, current, fields)
+	if err != nil {
+		return err
+	}
+	log.Infof("Rewrote config file %s: %s", current.Path, strings.Join(fields, ", "))
+	return nil
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/config"
+)
+
+// minimal valid config file, followed by the fields of a test
+const testConfigYAML = `
+tls_port: :6381
+jwt_organization: zedis_org
+jwt_namespace: zedis_namespace
+organization: zedis_0stor_org
+namespace: zedis_0stor_namespace
+iyo_app_id: app
+iyo_app_secret: secret
+data_shards: ["127.0.0.1:12345"]
+meta_shards: ["http://127.0.0.1:2379"]
+`
+
+func TestReloadConfig(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis_reload")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer setZConfig(zConfig())
+	defer func(sl *slowlog) { slowLog = sl }(slowLog)
+	slowLog = newSlowlog(128)
+
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(ioutil.WriteFile(path, []byte(testConfigYAML+"auth_commands: set\nport: :6380\n"), 0600))
+	cfg, err := config.NewZedisConfigFromFile(path)
+	if !assert.NoError(err) {
+		return
+	}
+	setZConfig(cfg)
+
+	// live fields are applied, the others are reported
+	assert.NoError(ioutil.WriteFile(path, []byte(testConfigYAML+`
+auth_commands: all
+port: :6390
+slowlog_max_len: 2
+acme_whitelist: [zedis.org]
+`), 0600))
+	restart, err := reloadConfig()
+	assert.NoError(err)
+	assert.Equal([]string{"port"}, restart)
+	assert.True(zConfig().AuthAll)
+	assert.Equal([]string{"zedis.org"}, zConfig().ACMEWhitelist)
+	assert.Equal(":6380", zConfig().Port)
+	assert.Len(slowLog.entries, 2)
+	assert.True(cfg != zConfig(), "the running config should be swapped, not modified")
+	assert.False(cfg.AuthAll)
+
+	// an invalid config is not applied
+	assert.NoError(ioutil.WriteFile(path, []byte("auth_commands: none\n"), 0600))
+	_, err = reloadConfig()
+	assert.Error(err)
+	assert.True(zConfig().AuthAll)
+
+	// an issuer with missing key files is not applied, nor the other changes
+	assert.NoError(ioutil.WriteFile(path, []byte(testConfigYAML+`
+auth_commands: set
+jwt_issuers:
+    - public_key_files: [`+filepath.Join(dir, "missing.pem")+`]
+`), 0600))
+	_, err = reloadConfig()
+	assert.Error(err)
+	assert.True(zConfig().AuthAll)
+
+	// CONFIG RELOAD
+	assert.NoError(ioutil.WriteFile(path, []byte(testConfigYAML+"auth_commands: set\n"), 0600))
+	conn := new(stubConn)
+	zConfig().AuthAll = false
+	getClient(conn).jwt = "aJWT"
+	defer removeClient(conn)
+	permissionValidator = stubAuthValidator
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("CONFIG"), []byte("RELOAD")}})
+	assert.Equal("OK", conn.s)
+	assert.False(zConfig().AuthAll)
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("CONFIG"), []byte("FOO")}})
+	assert.Equal("ERR unknown subcommand 'FOO'. Try CONFIG GET, SET, REWRITE or RELOAD.", conn.s)
+}
+
+func TestConfigGetSetRewrite(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis_config")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer setZConfig(zConfig())
+	defer func(sl *slowlog) { slowLog = sl }(slowLog)
+	slowLog = newSlowlog(128)
+
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(ioutil.WriteFile(path, []byte(testConfigYAML+"encrypt_key: topsecret\n"), 0600))
+	cfg, err := config.NewZedisConfigFromFile(path)
+	if !assert.NoError(err) {
+		return
+	}
+	setZConfig(cfg)
+
+	conn := new(recordConn)
+	getClient(conn).jwt = "aJWT"
+	defer removeClient(conn)
+	permissionValidator = stubAuthValidator
+	configCmd := func(args ...string) {
+		cmd := redcon.Command{Args: [][]byte{[]byte("CONFIG")}}
+		for _, arg := range args {
+			cmd.Args = append(cmd.Args, []byte(arg))
+		}
+		dispatch(conn, cmd)
+	}
+
+	configCmd("GET", "jwt_*")
+	configCmd("GET", "*secret*", "encrypt*")
+	configCmd("SET", "slowlog_max_len", "16", "AUTH_COMMANDS", "all")
+	configCmd("GET", "slowlog_max_len")
+	configCmd("SET", "port", ":6390")
+	configCmd("SET", "foo", "bar")
+	configCmd("SET", "slowlog_max_len", "ten")
+	configCmd("SET", "slowlog_max_len", "-1")
+	configCmd("SET", "slowlog_max_len")
+	assert.Equal([]string{
+		"*6", "jwt_organization", "zedis_org", "jwt_namespace", "zedis_namespace", "jwt_issuers", "",
+		"*2", "encrypt", "false",
+		"OK",
+		"*2", "slowlog_max_len", "16",
+		"ERR 'port' can't be changed on a running server, change it in the config file and restart",
+		"ERR Unknown option 'foo'",
+		"ERR Invalid argument: invalid value for 'slowlog_max_len': yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `ten` into int",
+		"ERR Invalid argument: invalid slowlog_max_len -1: can't be negative",
+		"ERR wrong number of arguments for 'CONFIG' command",
+	}, conn.replies)
+	assert.True(zConfig().AuthAll)
+	assert.Len(slowLog.entries, 16)
+
+	// only the changed fields are written to the file
+	conn.replies = nil
+	configCmd("REWRITE")
+	assert.Equal([]string{"OK"}, conn.replies)
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal(testConfigYAML+"encrypt_key: topsecret\nauth_commands: all\nslowlog_max_len: 16\n", string(data))
+
+	zConfig().Path = ""
+	conn.replies = nil
+	configCmd("REWRITE")
+	assert.Equal([]string{"ERR Rewriting config file: the server is running without a config file"}, conn.replies)
+}
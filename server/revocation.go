@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/server/jwt"
+)
+
+// checks if a JWT is revoked
+var jwtRevoked = func(jwtStr string) bool {
+	_, err := jwt.Scopes(jwtStr)
+	return err == jwt.ErrRevoked
+}
+
+func revokeCmd(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received REVOKE command from %s", remoteAddr(conn))
+
+	args := cmd.Args[1:]
+	switch strings.ToUpper(string(args[0])) {
+	case "ID":
+		if len(args) != 2 {
+			wrongArgCount(conn, cmd)
+			return
+		}
+		jwt.RevokeID(string(args[1]))
+	case "SUBJECT":
+		if len(args) != 2 && len(args) != 3 {
+			wrongArgCount(conn, cmd)
+			return
+		}
+		before, ok := issuedBefore(conn, args[2:])
+		if !ok {
+			return
+		}
+		jwt.RevokeSubject(string(args[1]), before)
+	case "BEFORE":
+		if len(args) > 2 {
+			wrongArgCount(conn, cmd)
+			return
+		}
+		before, ok := issuedBefore(conn, args[1:])
+		if !ok {
+			return
+		}
+		jwt.RevokeIssuedBefore(before)
+	case "REMOVE":
+		unrevoke(conn, cmd)
+		return
+	case "LIST":
+		revocations := jwt.Revocations()
+		conn.WriteArray(len(revocations))
+		for _, revocation := range revocations {
+			conn.WriteBulkString(revocation)
+		}
+		return
+	case "LOAD":
+		if zConfig().RevocationFile == "" {
+			conn.WriteError("ERR This Zedis instance is not configured to use a revocation file. Set revocation_file in the config.")
+			return
+		}
+		err := loadRevocations(zConfig().RevocationFile)
+		if err != nil {
+			conn.WriteError("ERR " + err.Error())
+			return
+		}
+		conn.WriteInt(cutOffRevoked())
+		return
+	default:
+		conn.WriteError("ERR unknown subcommand '" + string(args[0]) + "'. Try REVOKE ID, SUBJECT, BEFORE, REMOVE, LIST or LOAD.")
+		return
+	}
+
+	if !persistRevocations(conn) {
+		return
+	}
+	conn.WriteInt(cutOffRevoked())
+}
+
+// unrevoke handles REVOKE REMOVE ID|SUBJECT <value> and REVOKE REMOVE BEFORE
+// replies 1 when the revocation was removed, 0 when it didn't exist
+func unrevoke(conn redcon.Conn, cmd redcon.Command) {
+	args := cmd.Args[2:]
+	if len(args) == 0 {
+		wrongArgCount(conn, cmd)
+		return
+	}
+
+	var removed bool
+	switch kind := strings.ToUpper(string(args[0])); {
+	case kind == "BEFORE" && len(args) == 1:
+		removed = jwt.UnrevokeIssuedBefore()
+	case kind == "ID" && len(args) == 2:
+		removed = jwt.UnrevokeID(string(args[1]))
+	case kind == "SUBJECT" && len(args) == 2:
+		removed = jwt.UnrevokeSubject(string(args[1]))
+	default:
+		conn.WriteError("ERR syntax error. Try REVOKE REMOVE ID <jti>, SUBJECT <sub> or BEFORE.")
+		return
+	}
+
+	if !persistRevocations(conn) {
+		return
+	}
+	if removed {
+		conn.WriteInt(1)
+		return
+	}
+	conn.WriteInt(0)
+}
+
+// issuedBefore parses the optional unix time argument of a revocation, defaults to now
+// an error is written to the connection when it's invalid
+func issuedBefore(conn redcon.Conn, args [][]byte) (time.Time, bool) {
+	if len(args) == 0 {
+		return time.Now(), true
+	}
+	unix, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || unix < 0 {
+		conn.WriteError("ERR invalid unix time")
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+// persistRevocations saves the revocation list when a revocation file is configured
+// an error is written to the connection when saving fails
+func persistRevocations(conn redcon.Conn) bool {
+	if zConfig().RevocationFile == "" {
+		return true
+	}
+	err := saveRevocations(zConfig().RevocationFile)
+	if err != nil {
+		log.Errorf("failed to save revocation file: %v", err)
+		conn.WriteError("ERR revocation applied but not saved: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// cutOffRevoked closes the connections authenticated with a revoked JWT
+// returns the amount of closed connections
+func cutOffRevoked() int {
+	clientsLock.Lock()
+	conns := make(map[redcon.Conn]*client, len(clients))
+	for conn, c := range clients {
+		conns[conn] = c
+	}
+	clientsLock.Unlock()
+
+	closed := 0
+	for conn, c := range conns {
+		jwtStr := c.getJWT()
+		if jwtStr == "" || !jwtRevoked(jwtStr) {
+			continue
+		}
+		// the connection stays known until redcon cleaned it up
+		if !atomic.CompareAndSwapInt32(&c.cutOff, 0, 1) {
+			continue
+		}
+		// the address is set before the connection authenticated
+		addr := c.getAddr()
+		if addr == "" {
+			addr = conn.RemoteAddr()
+		}
+		log.Infof("closing connection %s authenticated with a revoked JWT", addr)
+		// the net.Conn is closed as the connection is served by another goroutine,
+		// redcon cleans it up when its read fails
+		if netConn := conn.NetConn(); netConn != nil {
+			netConn.Close()
+		}
+		closed++
+	}
+	return closed
+}
+
+// loadRevocations replaces the revocation list with the one of a revocation file
+func loadRevocations(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = jwt.SetRevocations(strings.Split(string(data), "\n"))
+	if err != nil {
+		return err
+	}
+	log.Infof("Loaded JWT revocations from %s", path)
+	return nil
+}
+
+// saveRevocations writes the revocation list to a revocation file
+// the file is written to a temporary file first, so it is never partially written
+func saveRevocations(path string) error {
+	var buf bytes.Buffer
+	for _, line := range jwt.Revocations() {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
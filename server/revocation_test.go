@@ -0,0 +1,105 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/server/jwt"
+)
+
+func TestRevokeCmd(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis_revocation")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer func(revoked func(string) bool) {
+		jwtRevoked = revoked
+		zConfig().RevocationFile = ""
+		jwt.SetRevocations(nil)
+	}(jwtRevoked)
+	zConfig().RevocationFile = filepath.Join(dir, "revoked")
+	permissionValidator = stubAuthValidator
+
+	// a connection using the JWT to be revoked
+	server, client := net.Pipe()
+	defer client.Close()
+	leaked := &stubConn{conn: server}
+	getClient(leaked).setJWT("leakedJWT")
+	defer removeClient(leaked)
+	jwtRevoked = func(jwtStr string) bool {
+		return jwtStr == "leakedJWT"
+	}
+
+	conn := new(recordConn)
+	getClient(conn).jwt = "adminJWT"
+	defer removeClient(conn)
+	revoke := func(args ...string) {
+		cmd := redcon.Command{Args: [][]byte{[]byte("REVOKE")}}
+		for _, arg := range args {
+			cmd.Args = append(cmd.Args, []byte(arg))
+		}
+		dispatch(conn, cmd)
+	}
+
+	revoke("ID", "abc")
+	revoke("SUBJECT", "alice", "100")
+	revoke("BEFORE", "soon")
+	revoke("LIST")
+	revoke("REMOVE", "ID", "abc")
+	revoke("REMOVE", "ID", "abc")
+	revoke("FOO")
+	assert.Equal([]string{
+		"1",
+		"0",
+		"ERR invalid unix time",
+		"*2", "id abc", "subject alice 100",
+		"1",
+		"0",
+		"ERR unknown subcommand 'FOO'. Try REVOKE ID, SUBJECT, BEFORE, REMOVE, LIST or LOAD.",
+	}, conn.replies)
+
+	// the connection using the revoked JWT is cut off
+	_, err = client.Read(make([]byte, 1))
+	assert.Error(err)
+
+	// revocations are persisted
+	data, err := ioutil.ReadFile(zConfig().RevocationFile)
+	assert.NoError(err)
+	assert.Equal("subject alice 100\n", string(data))
+
+	assert.NoError(ioutil.WriteFile(zConfig().RevocationFile, []byte("id def\n"), 0600))
+	conn.replies = nil
+	revoke("LOAD")
+	revoke("LIST")
+	// connections are only cut off once
+	assert.Equal([]string{"0", "*1", "id def"}, conn.replies)
+}
+
+func TestCutOffRevokedWhileAdmitting(t *testing.T) {
+	defer func(revoked func(string) bool) { jwtRevoked = revoked }(jwtRevoked)
+	jwtRevoked = func(jwtStr string) bool {
+		return jwtStr == "leakedJWT"
+	}
+
+	// the addresses of a proxied connection are set by its own goroutine
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := &stubConn{conn: server}
+	c := getClient(conn)
+	c.setJWT("leakedJWT")
+	defer removeClient(conn)
+	done := make(chan struct{})
+	go func() {
+		c.setAddrs("203.0.113.7:5000", "10.0.0.1:6379")
+		close(done)
+	}()
+	assert.Equal(t, 1, cutOffRevoked())
+	<-done
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+)
+
+// CA signing the self signed certificates
+// nil when the TLS port doesn't use self signed certificates
+var selfSignedCA *localCA
+
+// file names of the CA in the CA directory
+const (
+	caCertFile = "ca.pem"
+	caKeyFile  = "ca_key.pem"
+)
+
+// localCA is a self signed CA issuing the certificates of the TLS port
+type localCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// loadOrCreateCA loads the CA from a directory, a new CA is created and saved to the directory when it has none
+// the CA is only kept in memory when no directory is given
+func loadOrCreateCA(dir string) (*localCA, error) {
+	if dir == "" {
+		return genCA()
+	}
+
+	certPath, keyPath := filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile)
+	certPEM, err := ioutil.ReadFile(certPath)
+	if os.IsNotExist(err) {
+		ca, err := genCA()
+		if err != nil {
+			return nil, err
+		}
+		err = ca.save(dir)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Created self signed CA in %s with fingerprint %s", dir, ca.fingerprint())
+		return ca, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid self signed CA in %s: %v", dir, err)
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid self signed CA in %s: not an ECDSA key", dir)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("invalid self signed CA in %s: not a CA certificate", dir)
+	}
+	if time.Now().After(cert.NotAfter) {
+		return nil, fmt.Errorf("self signed CA in %s expired at %s, remove it to create a new one", dir, cert.NotAfter)
+	}
+	return &localCA{cert: cert, key: key}, nil
+}
+
+// genCA generates an in memory CA
+func genCA() (*localCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"zedis self-signed"},
+			CommonName:   "zedis self-signed CA",
+		},
+		NotBefore:             now.Add(-24 * time.Hour), // 1 day ago, in case of clock drift.
+		NotAfter:              now.Add(caLifespan),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &localCA{cert: cert, key: key}, nil
+}
+
+// save writes the CA certificate and key to a directory
+func (ca *localCA) save(dir string) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalECPrivateKey(ca.key)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, caKeyFile), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, caCertFile), ca.pem(), 0644)
+}
+
+// issue generates a certificate signed by the CA for hostnames and IP addresses
+func (ca *localCA) issue(hosts []string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"zedis self-signed"},
+			CommonName:   hosts[0],
+		},
+		NotBefore:   now.Add(-time.Hour), // in case of clock drift.
+		NotAfter:    now.Add(certLifespan),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	// the certificate doesn't outlive the CA
+	if template.NotAfter.After(ca.cert.NotAfter) {
+		template.NotAfter = ca.cert.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// pem returns the PEM encoded CA certificate
+func (ca *localCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// fingerprint returns the SHA-256 fingerprint of the CA certificate, as colon separated hex
+func (ca *localCA) fingerprint() string {
+	sum := sha256.Sum256(ca.cert.Raw)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, ":")
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// tlsCACmd replies the PEM encoded CA certificate or its fingerprint,
+// so clients can trust the self signed certificates of the TLS port
+// it always requires authentication, so the CA isn't handed to anyone reaching the port
+func tlsCACmd(conn redcon.Conn, cmd redcon.Command) {
+	log.Debugf("received TLSCA command from %s", remoteAddr(conn))
+
+	if selfSignedCA == nil {
+		conn.WriteError("ERR This Zedis instance does not use self signed TLS certificates")
+		return
+	}
+	switch strings.ToUpper(string(cmd.Args[1])) {
+	case "PEM":
+		conn.WriteBulk(selfSignedCA.pem())
+	case "FINGERPRINT":
+		conn.WriteBulkString(selfSignedCA.fingerprint())
+	default:
+		conn.WriteError("ERR unknown subcommand '" + string(cmd.Args[1]) + "'. Try TLSCA PEM or FINGERPRINT.")
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+)
+
+func TestLocalCA(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis_ca")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	caDir := filepath.Join(dir, "ca")
+
+	// the CA is created once and persisted
+	ca, err := loadOrCreateCA(caDir)
+	if !assert.NoError(err) {
+		return
+	}
+	loaded, err := loadOrCreateCA(caDir)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(ca.fingerprint(), loaded.fingerprint())
+	assert.Len(ca.fingerprint(), 32*3-1)
+	info, err := os.Stat(filepath.Join(caDir, caKeyFile))
+	if assert.NoError(err) {
+		assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// issued certificates verify against the CA, with the hosts as SANs
+	cert, err := loaded.issue([]string{"zedis.org", "10.0.0.1"})
+	if !assert.NoError(err) {
+		return
+	}
+	leaf := cert.Leaf
+	assert.False(leaf.IsCA)
+	assert.Equal([]string{"zedis.org"}, leaf.DNSNames)
+	assert.True(net.ParseIP("10.0.0.1").Equal(leaf.IPAddresses[0]))
+	assert.Equal(certLifespan.Hours(), leaf.NotAfter.Sub(leaf.NotBefore).Hours()-1)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem())
+	for _, host := range []string{"zedis.org", "10.0.0.1"} {
+		_, err = leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots})
+		assert.NoError(err, host)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "other.org", Roots: roots})
+	assert.Error(err)
+
+	// an invalid CA is not replaced
+	assert.NoError(ioutil.WriteFile(filepath.Join(caDir, caKeyFile), []byte("invalid"), 0600))
+	_, err = loadOrCreateCA(caDir)
+	assert.Error(err)
+}
+
+func TestTLSCACmd(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { selfSignedCA = nil }()
+	permissionValidator = stubAuthValidator
+	conn := new(stubConn)
+	defer removeClient(conn)
+	tlsca := func(sub string) {
+		dispatch(conn, redcon.Command{Args: [][]byte{[]byte("TLSCA"), []byte(sub)}})
+	}
+
+	// the CA is only handed to authenticated clients
+	tlsca("PEM")
+	assert.Equal(unAuthMsg, conn.s)
+
+	getClient(conn).jwt = "aJWT"
+	tlsca("PEM")
+	assert.Equal("ERR This Zedis instance does not use self signed TLS certificates", conn.s)
+
+	ca, err := genCA()
+	if !assert.NoError(err) {
+		return
+	}
+	selfSignedCA = ca
+	tlsca("pem")
+	assert.Equal(string(ca.pem()), conn.s)
+	tlsca("FINGERPRINT")
+	assert.Equal(ca.fingerprint(), conn.s)
+	tlsca("FOO")
+	assert.Equal("ERR unknown subcommand 'FOO'. Try TLSCA PEM or FINGERPRINT.", conn.s)
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+)
+
+const (
+	// amount of entries returned by SLOWLOG GET when no count is given
+	defaultSlowlogGetCount = 10
+	// maximum amount of arguments stored for a command
+	slowlogMaxArgc = 32
+	// arguments longer than this are truncated
+	slowlogMaxArgLen = 128
+)
+
+// slowLog keeps the commands that exceeded the latency threshold
+var slowLog = newSlowlog(128)
+
+// slowlogEntry represents a logged slow command
+type slowlogEntry struct {
+	id        int64
+	timestamp time.Time
+	duration  time.Duration
+	args      []string
+	addr      string
+	// time spent in the 0-stor and validating JWTs during the command
+	storTime time.Duration
+	jwtTime  time.Duration
+}
+
+// slowlog is a ring buffer of slow commands
+type slowlog struct {
+	lock    sync.Mutex
+	entries []slowlogEntry
+	// index where the next entry will be written
+	next int
+	// amount of entries in the ring
+	size   int
+	nextID int64
+}
+
+func newSlowlog(maxLen int) *slowlog {
+	return &slowlog{
+		entries: make([]slowlogEntry, maxLen),
+	}
+}
+
+// add adds an entry to the slowlog, overwriting the oldest when full
+func (sl *slowlog) add(entry slowlogEntry) {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	if len(sl.entries) == 0 {
+		return
+	}
+
+	entry.id = sl.nextID
+	sl.nextID++
+	sl.entries[sl.next] = entry
+	sl.next = (sl.next + 1) % len(sl.entries)
+	if sl.size < len(sl.entries) {
+		sl.size++
+	}
+}
+
+// get returns up to count entries, newest first
+// a negative count returns all entries
+func (sl *slowlog) get(count int) []slowlogEntry {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	if count < 0 || count > sl.size {
+		count = sl.size
+	}
+
+	entries := make([]slowlogEntry, 0, count)
+	for i := 1; i <= count; i++ {
+		idx := (sl.next - i + len(sl.entries)) % len(sl.entries)
+		entries = append(entries, sl.entries[idx])
+	}
+	return entries
+}
+
+func (sl *slowlog) len() int {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	return sl.size
+}
+
+// resize changes the maximum amount of entries, keeping the newest entries
+func (sl *slowlog) resize(maxLen int) {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	if maxLen == len(sl.entries) {
+		return
+	}
+
+	size := sl.size
+	if size > maxLen {
+		size = maxLen
+	}
+	entries := make([]slowlogEntry, maxLen)
+	// oldest kept entry first
+	for i := 0; i < size; i++ {
+		entries[i] = sl.entries[(sl.next-size+i+len(sl.entries))%len(sl.entries)]
+	}
+	sl.entries = entries
+	sl.size = size
+	sl.next = 0
+	if maxLen > 0 {
+		sl.next = size % maxLen
+	}
+}
+
+func (sl *slowlog) reset() {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	sl.next = 0
+	sl.size = 0
+}
+
+// logIfSlow adds a processed command to the slowlog
+// when it took longer than the configured threshold
+func logIfSlow(conn redcon.Conn, cmd redcon.Command, start time.Time, duration time.Duration) {
+	threshold := zConfig().SlowlogLogSlowerThan
+	if threshold < 0 || duration < time.Duration(threshold)*time.Microsecond {
+		return
+	}
+
+	storTime, jwtTime := commandTimings(conn)
+	slowLog.add(slowlogEntry{
+		timestamp: start,
+		duration:  duration,
+		args:      slowlogArgs(cmd),
+		addr:      remoteAddr(conn),
+		storTime:  storTime,
+		jwtTime:   jwtTime,
+	})
+}
+
+// slowlogArgs returns the arguments of a command as stored in the slowlog
+// long and excess arguments are truncated and secrets are redacted
+func slowlogArgs(cmd redcon.Command) []string {
+	cmd.Args = redactArgs(cmd.Args)
+
+	argc := len(cmd.Args)
+	if argc > slowlogMaxArgc {
+		argc = slowlogMaxArgc
+	}
+	args := make([]string, 0, argc)
+	for i := 0; i < argc; i++ {
+		// last stored argument notes how many arguments were left out
+		if i == slowlogMaxArgc-1 && len(cmd.Args) > slowlogMaxArgc {
+			args = append(args, "... ("+strconv.Itoa(len(cmd.Args)-slowlogMaxArgc+1)+" more arguments)")
+			break
+		}
+		arg := cmd.Args[i]
+		if len(arg) > slowlogMaxArgLen {
+			args = append(args, string(arg[:slowlogMaxArgLen])+"... ("+strconv.Itoa(len(arg)-slowlogMaxArgLen)+" more bytes)")
+			continue
+		}
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+// writeSlowlogEntries writes slowlog entries in the SLOWLOG GET reply format
+// the 0-stor and JWT validation time are appended to the standard Redis fields
+func writeSlowlogEntries(conn redcon.Conn, entries []slowlogEntry) {
+	conn.WriteArray(len(entries))
+	for _, e := range entries {
+		conn.WriteArray(8)
+		conn.WriteInt64(e.id)
+		conn.WriteInt64(e.timestamp.Unix())
+		conn.WriteInt64(int64(e.duration / time.Microsecond))
+		conn.WriteArray(len(e.args))
+		for _, arg := range e.args {
+			conn.WriteBulkString(arg)
+		}
+		conn.WriteBulkString(e.addr)
+		// client name, not supported by zedis
+		conn.WriteBulkString("")
+		conn.WriteInt64(int64(e.storTime / time.Microsecond))
+		conn.WriteInt64(int64(e.jwtTime / time.Microsecond))
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+)
+
+func TestSlowlogRing(t *testing.T) {
+	assert := assert.New(t)
+	sl := newSlowlog(3)
+
+	for i := 0; i < 5; i++ {
+		sl.add(slowlogEntry{duration: time.Duration(i)})
+	}
+	assert.Equal(3, sl.len())
+
+	// newest first, oldest entries are overwritten
+	entries := sl.get(-1)
+	if assert.Len(entries, 3) {
+		assert.Equal(int64(4), entries[0].id)
+		assert.Equal(int64(3), entries[1].id)
+		assert.Equal(int64(2), entries[2].id)
+	}
+
+	entries = sl.get(1)
+	if assert.Len(entries, 1) {
+		assert.Equal(int64(4), entries[0].id)
+	}
+
+	sl.reset()
+	assert.Equal(0, sl.len())
+	assert.Empty(sl.get(10))
+
+	// ids keep increasing after a reset
+	sl.add(slowlogEntry{})
+	assert.Equal(int64(5), sl.get(1)[0].id)
+}
+
+func TestSlowlogResize(t *testing.T) {
+	assert := assert.New(t)
+	sl := newSlowlog(3)
+	for i := 0; i < 5; i++ {
+		sl.add(slowlogEntry{})
+	}
+
+	// shrinking keeps the newest entries
+	sl.resize(2)
+	ids := func() []int64 {
+		var ids []int64
+		for _, entry := range sl.get(-1) {
+			ids = append(ids, entry.id)
+		}
+		return ids
+	}
+	assert.Equal([]int64{4, 3}, ids())
+
+	// growing keeps all entries
+	sl.resize(4)
+	sl.add(slowlogEntry{})
+	assert.Equal([]int64{5, 4, 3}, ids())
+
+	sl.resize(0)
+	sl.add(slowlogEntry{})
+	assert.Empty(ids())
+}
+
+func TestSlowlogArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	// AUTH tokens are redacted
+	args := slowlogArgs(redcon.Command{Args: [][]byte{
+		[]byte("auth"),
+		[]byte("aJWT"),
+	}})
+	assert.Equal([]string{"auth", "(redacted)"}, args)
+
+	// long arguments are truncated
+	long := strings.Repeat("a", slowlogMaxArgLen+10)
+	args = slowlogArgs(redcon.Command{Args: [][]byte{
+		[]byte("SET"),
+		[]byte("key"),
+		[]byte(long),
+	}})
+	assert.Equal([]string{"SET", "key", long[:slowlogMaxArgLen] + "... (10 more bytes)"}, args)
+
+	// excess arguments are left out
+	cmd := redcon.Command{Args: [][]byte{[]byte("EXISTS")}}
+	for i := 0; i < slowlogMaxArgc+5; i++ {
+		cmd.Args = append(cmd.Args, []byte("key"))
+	}
+	args = slowlogArgs(cmd)
+	assert.Len(args, slowlogMaxArgc)
+	assert.Equal("... (7 more arguments)", args[slowlogMaxArgc-1])
+}
+
+func TestLogIfSlow(t *testing.T) {
+	assert := assert.New(t)
+	slowLog = newSlowlog(10)
+	conn := new(stubConn)
+	cmd := redcon.Command{Args: [][]byte{[]byte("GET"), []byte("key")}}
+	c := getClient(conn)
+	c.storTime = 3 * time.Millisecond
+	c.jwtTime = time.Millisecond
+
+	zConfig().SlowlogLogSlowerThan = 5000
+	logIfSlow(conn, cmd, time.Now(), 4*time.Millisecond)
+	assert.Equal(0, slowLog.len(), "command faster than threshold should not be logged")
+
+	logIfSlow(conn, cmd, time.Now(), 6*time.Millisecond)
+	if assert.Equal(1, slowLog.len()) {
+		e := slowLog.get(1)[0]
+		assert.Equal([]string{"GET", "key"}, e.args)
+		assert.Equal(6*time.Millisecond, e.duration)
+		assert.Equal(3*time.Millisecond, e.storTime)
+		assert.Equal(time.Millisecond, e.jwtTime)
+		assert.Equal("127.0.0.1", e.addr)
+	}
+
+	zConfig().SlowlogLogSlowerThan = -1
+	logIfSlow(conn, cmd, time.Now(), time.Hour)
+	assert.Equal(1, slowLog.len(), "slowlog should be disabled")
+
+	zConfig().SlowlogLogSlowerThan = 0
+}
+
+func TestSlowlogCmd(t *testing.T) {
+	permissionValidator = stubAuthValidator
+	slowLog = newSlowlog(10)
+	slowLog.add(slowlogEntry{args: []string{"GET", "key"}})
+	conn := new(stubConn)
+	var cmd redcon.Command
+
+	// missing jwt
+	cmd.Args = [][]byte{
+		[]byte("SLOWLOG"),
+		[]byte("LEN"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, unAuthMsg, conn.s)
+
+	getClient(conn).jwt = "aJWT"
+	dispatch(conn, cmd)
+	assert.Equal(t, "1", conn.s)
+
+	// get returns the amount of entries
+	cmd.Args = [][]byte{
+		[]byte("SLOWLOG"),
+		[]byte("GET"),
+		[]byte("5"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "0", conn.s, "last reply should be the jwt time of the entry")
+
+	cmd.Args = [][]byte{
+		[]byte("SLOWLOG"),
+		[]byte("GET"),
+		[]byte("five"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "ERR value is not an integer or out of range", conn.s)
+
+	cmd.Args = [][]byte{
+		[]byte("SLOWLOG"),
+		[]byte("RESET"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "OK", conn.s)
+	assert.Equal(t, 0, slowLog.len())
+
+	cmd.Args = [][]byte{
+		[]byte("SLOWLOG"),
+		[]byte("FOO"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "ERR unknown subcommand 'FOO'. Try SLOWLOG GET, LEN or RESET.", conn.s)
+
+	// invalid command length
+	cmd.Args = [][]byte{
+		[]byte("SLOWLOG"),
+	}
+	dispatch(conn, cmd)
+	assert.Equal(t, "ERR wrong number of arguments for 'SLOWLOG' command", conn.s)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zero-os/zedis/server/jwt"
+	"github.com/zero-os/zedis/stor"
+)
+
+var (
+	// fetches the scopes of a JWT to route its connection to a tenant
+	scopesFetcher = jwt.Scopes
+	// creates the stor client of a tenant
+	newTenantStor = func(name string) (stor.Client, error) {
+		client, err := stor.NewStor(zConfig().TenantStorPolicy(name))
+		if err != nil {
+			return nil, err
+		}
+		return meteredStor{client}, nil
+	}
+
+	// stor clients of the tenants, created on first use
+	tenantStorClients = make(map[string]stor.Client)
+	tenantStorLock    = new(sync.Mutex)
+
+	errMultipleTenants = errors.New("JWT has scopes of more than one tenant")
+)
+
+// tenantOf returns the tenant a JWT routes the connection to
+// returns an empty string when tenants are disabled or the JWT has no tenant scopes
+// time spent fetching the scopes is added to the client's command timings
+func (c *client) tenantOf(jwtStr string) (string, error) {
+	if zConfig().Tenants == nil {
+		return "", nil
+	}
+	defer func(start time.Time) {
+		c.jwtTime += time.Since(start)
+	}(time.Now())
+
+	scopes, err := scopesFetcher(jwtStr)
+	if err != nil {
+		return "", err
+	}
+
+	var tenant string
+	for _, namespace := range jwt.Namespaces(zConfig().Tenants.JWTOrganization, scopes) {
+		if !zConfig().ValidTenant(namespace) {
+			continue
+		}
+		if tenant != "" {
+			return "", errMultipleTenants
+		}
+		tenant = namespace
+	}
+	return tenant, nil
+}
+
+// tenantStor returns the stor client of a tenant
+// the client is created the first time a tenant is used
+func tenantStor(name string) (stor.Client, error) {
+	tenantStorLock.Lock()
+	defer tenantStorLock.Unlock()
+
+	if sc, ok := tenantStorClients[name]; ok {
+		return sc, nil
+	}
+
+	sc, err := newTenantStor(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stor client for tenant %s: %v", name, err)
+	}
+	sc = prefixedStor{
+		Client: sc,
+		prefix: []byte(name + ":"),
+	}
+	tenantStorClients[name] = sc
+	return sc, nil
+}
+
+// prefixedStor prefixes the keys with the tenant name,
+// so keys of tenants never collide, even when sharing a 0-stor namespace
+type prefixedStor struct {
+	stor.Client
+	prefix []byte
+}
+
+func (ps prefixedStor) Read(ctx context.Context, key []byte) ([]byte, error) {
+	return ps.Client.Read(ctx, ps.key(key))
+}
+
+func (ps prefixedStor) Write(ctx context.Context, key []byte, value []byte) error {
+	return ps.Client.Write(ctx, ps.key(key), value)
+}
+
+func (ps prefixedStor) KeyExists(ctx context.Context, key []byte) (bool, error) {
+	return ps.Client.KeyExists(ctx, ps.key(key))
+}
+
+func (ps prefixedStor) key(key []byte) []byte {
+	prefixed := make([]byte, 0, len(ps.prefix)+len(key))
+	prefixed = append(prefixed, ps.prefix...)
+	return append(prefixed, key...)
+}
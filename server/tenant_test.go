@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/config"
+	"github.com/zero-os/zedis/server/jwt"
+	"github.com/zero-os/zedis/stor"
+)
+
+func TestTenantRouting(t *testing.T) {
+	assert := assert.New(t)
+	defer func(newStor func(string) (stor.Client, error)) {
+		newTenantStor = newStor
+		zConfig().Tenants = nil
+		zConfig().JWTOrganization = ""
+		zConfig().JWTNamespace = ""
+		scopesFetcher = jwt.Scopes
+		tenantStorClients = make(map[string]stor.Client)
+	}(newTenantStor)
+	zConfig().JWTOrganization = "org"
+	zConfig().JWTNamespace = "ns"
+	zConfig().Tenants = &config.Tenants{JWTOrganization: "org", NamespacePrefix: "tenant_"}
+
+	tenantStors := make(map[string]*stubStorClient)
+	newTenantStor = func(name string) (stor.Client, error) {
+		sc := newStubStorClient()
+		tenantStors[name] = sc
+		return sc, nil
+	}
+	jwtScopes := map[string][]string{
+		"teamA":   {"org.teamA.write", "org.teamA.read"},
+		"teamB":   {"org.teamB.write"},
+		"main":    {"org.ns"},
+		"both":    {"org.teamA", "org.teamB"},
+		"invalid": nil,
+	}
+	scopesFetcher = func(jwtStr string) ([]string, error) {
+		if jwtStr == "invalid" {
+			return nil, errors.New("a stub error")
+		}
+		return jwtScopes[jwtStr], nil
+	}
+	var organization, namespace string
+	permissionValidator = func(jwtStr, org, ns string, getExpectedScopes jwt.GetScopes) error {
+		organization, namespace = org, ns
+		return nil
+	}
+	main := newStubStorClient()
+	storClient = main
+
+	set := func(conn redcon.Conn, jwtStr string) {
+		dispatch(conn, redcon.Command{Args: [][]byte{[]byte("AUTH"), []byte(jwtStr)}})
+		dispatch(conn, redcon.Command{Args: [][]byte{[]byte("SET"), []byte("key"), []byte(jwtStr)}})
+	}
+
+	// each tenant writes the same key to its own stor
+	connA, connB, connMain := new(stubConn), new(stubConn), new(stubConn)
+	set(connA, "teamA")
+	assert.Equal("OK", connA.s)
+	assert.Equal("org", organization)
+	assert.Equal("teamA", namespace)
+	set(connB, "teamB")
+	assert.Equal("OK", connB.s)
+	assert.Equal("teamB", namespace)
+	set(connMain, "main")
+	assert.Equal("OK", connMain.s)
+	assert.Equal("ns", namespace)
+
+	// the stor of a tenant is only created once and keys are prefixed with the tenant
+	assert.Len(tenantStors, 2)
+	assert.Equal(map[string][]byte{"teamA:key": []byte("teamA")}, tenantStors["teamA"].stor)
+	assert.Equal(map[string][]byte{"teamB:key": []byte("teamB")}, tenantStors["teamB"].stor)
+	assert.Equal(map[string][]byte{"key": []byte("main")}, main.stor)
+
+	dispatch(connA, redcon.Command{Args: [][]byte{[]byte("GET"), []byte("key")}})
+	assert.Equal("teamA", connA.s)
+
+	// tenants only have database 0
+	zConfig().Databases = []config.Database{{Index: 1, Namespace: "ns1"}}
+	defer func() { zConfig().Databases = nil }()
+	dispatch(connA, redcon.Command{Args: [][]byte{[]byte("SELECT"), []byte("1")}})
+	assert.Equal("ERR DB index is out of range", connA.s)
+
+	// a JWT can't route to more than one tenant
+	dispatch(connA, redcon.Command{Args: [][]byte{[]byte("AUTH"), []byte("both")}})
+	assert.Equal("ERR invalid JWT: "+errMultipleTenants.Error(), connA.s)
+	assert.Equal("teamA", getClient(connA).tenant)
+
+	dispatch(connA, redcon.Command{Args: [][]byte{[]byte("AUTH"), []byte("invalid")}})
+	assert.Equal("ERR invalid JWT: a stub error", connA.s)
+	assert.Equal("teamA", getClient(connA).tenant)
+
+	// authenticating without tenant scopes leaves the tenant
+	dispatch(connA, redcon.Command{Args: [][]byte{[]byte("AUTH"), []byte("main")}})
+	assert.Equal("OK", connA.s)
+	assert.Empty(getClient(connA).tenant)
+}
+
+func TestTenantAdminServerCommands(t *testing.T) {
+	assert := assert.New(t)
+	defer func(newStor func(string) (stor.Client, error)) {
+		newTenantStor = newStor
+		zConfig().Tenants = nil
+		zConfig().JWTOrganization = ""
+		zConfig().JWTNamespace = ""
+		scopesFetcher = jwt.Scopes
+		tenantStorClients = make(map[string]stor.Client)
+	}(newTenantStor)
+	zConfig().JWTOrganization = "org"
+	zConfig().JWTNamespace = "ns"
+	zConfig().Tenants = &config.Tenants{JWTOrganization: "tenants", NamespacePrefix: "tenant_"}
+	newTenantStor = func(name string) (stor.Client, error) {
+		return newStubStorClient(), nil
+	}
+	jwtScopes := map[string][]string{
+		"teamAAdmin": {"tenants.teamA"},
+	}
+	scopesFetcher = func(jwtStr string) ([]string, error) {
+		return jwtScopes[jwtStr], nil
+	}
+	permissionValidator = scopesValidator(jwtScopes)
+
+	conn := new(stubConn)
+	defer removeClient(conn)
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("AUTH"), []byte("teamAAdmin")}})
+	assert.Equal("OK", conn.s)
+	assert.Equal("teamA", getClient(conn).tenant)
+	dispatch(conn, redcon.Command{Args: [][]byte{[]byte("SET"), []byte("key"), []byte("value")}})
+	assert.Equal("OK", conn.s, "admin of the tenant")
+
+	// server commands affect all tenants and databases
+	for _, args := range []string{"CONFIG GET port", "CONFIG SET maxclients 1", "ACL SETUSER x on >pw +@all ~*", "MONITOR", "CLIENT LIST", "REVOKE BEFORE"} {
+		conn.s = ""
+		dispatch(conn, redcon.Command{Args: bytes.Fields([]byte(args))})
+		assert.Equal("ERR JWT invalid: "+jwt.ErrMissingScope.Error(), conn.s, args)
+	}
+	assert.Empty(listACLUsers(), "no ACL user was created")
+}
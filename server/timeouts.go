@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+)
+
+// newCommandContext returns the context of a command,
+// which passes its deadline after the configured command timeout
+func newCommandContext() (context.Context, context.CancelFunc) {
+	timeout := zConfig().CommandTimeout
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(timeout)*time.Millisecond)
+}
+
+// commandContext returns the context of the command processed on a connection
+func commandContext(conn redcon.Conn) context.Context {
+	if ctx, ok := conn.Context().(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// extendIdleTimeout closes the connection when it doesn't send a command within the configured timeout
+func extendIdleTimeout(conn redcon.Conn) {
+	netConn := conn.NetConn()
+	if netConn == nil {
+		return
+	}
+	var deadline time.Time
+	if timeout := zConfig().Timeout; timeout > 0 {
+		deadline = time.Now().Add(time.Duration(timeout) * time.Second)
+	}
+	// redcon closes the connection when reading fails
+	err := netConn.SetReadDeadline(deadline)
+	if err != nil {
+		log.Debugf("failed to set the idle timeout of %s: %v", remoteAddr(conn), err)
+	}
+}
+
+// clearIdleTimeout makes a connection never time out, e.g. when monitoring
+func clearIdleTimeout(conn redcon.Conn) {
+	if netConn := conn.NetConn(); netConn != nil {
+		netConn.SetReadDeadline(time.Time{})
+	}
+}
+
+// setKeepAlive configures TCP keepalive of an accepted connection
+func setKeepAlive(netConn net.Conn, period time.Duration) error {
+	if tlsConn, ok := netConn.(*tls.Conn); ok {
+		netConn = tlsConn.NetConn()
+	}
+	if pc, ok := netConn.(*proxyConn); ok {
+		netConn = pc.Conn
+	}
+	tcpConn, ok := netConn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if period <= 0 {
+		return tcpConn.SetKeepAlive(false)
+	}
+	err := tcpConn.SetKeepAlive(true)
+	if err != nil {
+		return err
+	}
+	return tcpConn.SetKeepAlivePeriod(period)
+}
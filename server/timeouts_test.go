@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+	"github.com/zero-os/zedis/stor"
+)
+
+func TestCommandTimeout(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.CommandTimeout = 10
+	setZConfig(&cfg)
+
+	permissionValidator = stubAuthValidator
+	sc := &hangingStorClient{release: make(chan struct{})}
+	defer close(sc.release)
+	storClient = sc
+
+	conn := new(stubConn)
+	getClient(conn).jwt = "aJWT"
+	defer removeClient(conn)
+
+	handler(conn, redcon.Command{Args: [][]byte{[]byte("GET"), []byte("key")}})
+	assert.Equal("ERR reading from the stor: "+stor.ErrTimeout.Error(), conn.s)
+	handler(conn, redcon.Command{Args: [][]byte{[]byte("SET"), []byte("key"), []byte("value")}})
+	assert.Equal("ERR writing to the stor: "+stor.ErrTimeout.Error(), conn.s)
+	handler(conn, redcon.Command{Args: [][]byte{[]byte("EXISTS"), []byte("key")}})
+	assert.Equal("ERR checking the stor: "+stor.ErrTimeout.Error(), conn.s)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	cfg.Timeout = 1
+	setZConfig(&cfg)
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	conn := &stubConn{conn: server}
+
+	extendIdleTimeout(conn)
+	start := time.Now()
+	_, err := server.Read(make([]byte, 1))
+	if assert.Error(err) {
+		netErr, ok := err.(net.Error)
+		assert.True(ok && netErr.Timeout(), "idle connections time out")
+	}
+	assert.True(time.Since(start) >= 900*time.Millisecond)
+
+	clearIdleTimeout(conn)
+	go client.Write([]byte("x"))
+	_, err = server.Read(make([]byte, 1))
+	assert.NoError(err, "deadline is cleared")
+}
+
+func TestSetKeepAlive(t *testing.T) {
+	assert := assert.New(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer l.Close()
+	go func() {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 1))
+		}
+	}()
+	conn, err := l.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	assert.NoError(setKeepAlive(conn, time.Minute))
+	assert.NoError(setKeepAlive(conn, 0))
+	pipe, _ := net.Pipe()
+	assert.NoError(setKeepAlive(pipe, time.Minute), "not a TCP connection")
+}
+
+// hangingStorClient doesn't reply until released or the context is done
+type hangingStorClient struct {
+	stubStorClient
+	release chan struct{}
+}
+
+func (c *hangingStorClient) wait(ctx context.Context) error {
+	select {
+	case <-c.release:
+		return nil
+	case <-ctx.Done():
+		return stor.ErrTimeout
+	}
+}
+
+func (c *hangingStorClient) Read(ctx context.Context, key []byte) ([]byte, error) {
+	return nil, c.wait(ctx)
+}
+func (c *hangingStorClient) Write(ctx context.Context, key []byte, value []byte) error {
+	return c.wait(ctx)
+}
+func (c *hangingStorClient) KeyExists(ctx context.Context, key []byte) (bool, error) {
+	return false, c.wait(ctx)
+}
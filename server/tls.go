@@ -1,27 +1,26 @@
 package server
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"math/big"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/zero-os/zedis/config"
-	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/crypto/acme"
 )
 
 var (
+	// how long the self signed CA is valid
+	caLifespan = 3650 * (24 * time.Hour)
 	// how long self signed certificates are valid
-	certLifespan = 3650 * (24 * time.Hour)
+	certLifespan = 30 * (24 * time.Hour)
 	// renewInterval is how often to check the self signed certificates for renewal
 	renewInterval = 24 * time.Hour
 	// renewDurationBefore is how long before expiration to renew certificates.
-	renewDurationBefore = 30 * (24 * time.Hour)
+	renewDurationBefore = 10 * (24 * time.Hour)
+	// hostnames of the self signed certificates when none are configured
+	defaultHostnames = []string{"localhost", "127.0.0.1", "::1"}
 	// selfsigned certificate cache
 	certCache *tls.Certificate
 	// selfsigned certificate lock
@@ -30,42 +29,78 @@ var (
 
 // tlsConfig returns a TLS config from provided Zedis config
 func tlsConfig(zc *config.Zedis) (*tls.Config, error) {
+	var getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	var renewer func()
+	var nextProtos []string
+
+	switch {
 	// When ACME (let's encrypt is requested by config)
-	if zc.ACME {
+	case zc.ACME:
 		log.Debug("Using ACME (let's encrypt) TLS certificates")
-		m := &autocert.Manager{
-			Prompt: autocert.AcceptTOS,
+		m, err := acmeManager(zc)
+		if err != nil {
+			return nil, err
 		}
-		if len(zc.ACMEWhitelist) > 0 {
-			m.HostPolicy = autocert.HostWhitelist(zc.ACMEWhitelist...)
+		acmeCertManager = m
+		getCertificate = recordACMELeaves(m.GetCertificate)
+		// answers TLS-ALPN challenges
+		nextProtos = []string{acme.ALPNProto}
+
+	// Certificate files, reloaded when they change
+	case zc.TLSCertFile != "":
+		log.Debug("Using TLS certificate files")
+		files := certFiles{cert: zc.TLSCertFile, key: zc.TLSKeyFile, chain: zc.TLSChainFile}
+		cert, err := files.load()
+		if err != nil {
+			return nil, err
 		}
-		return &tls.Config{
-			MinVersion:     tls.VersionTLS11,
-			GetCertificate: m.GetCertificate,
-		}, nil
-	}
+		certCacheLock = new(sync.Mutex)
+		certCache = cert
+		getCertificate = getCert
+		renewer = func() { certFileWatcher(files) }
 
 	// In memory self signed certificates
-	log.Debug("Using self generated TLS certificates")
+	default:
+		log.Debug("Using self generated TLS certificates")
+		ca, err := loadOrCreateCA(zc.TLSCADir)
+		if err != nil {
+			return nil, err
+		}
+		hosts := zc.TLSHostnames
+		if len(hosts) == 0 {
+			hosts = defaultHostnames
+		}
+		cert, err := ca.issue(hosts)
+		if err != nil {
+			return nil, err
+		}
+		selfSignedCA = ca
+		certCacheLock = new(sync.Mutex)
+		certCache = cert
+		getCertificate = getCert
+		renewer = func() { certUpgrader(ca, hosts) }
+	}
 
-	cert, err := genCertPair()
+	config := &tls.Config{
+		MinVersion:     zc.TLSMinVersionID,
+		CipherSuites:   zc.TLSCipherSuiteIDs,
+		GetCertificate: getCertificate,
+		NextProtos:     nextProtos,
+	}
+	err := configureClientAuth(config, zc.TLSClientAuth)
 	if err != nil {
 		return nil, err
 	}
-	certCacheLock = new(sync.Mutex)
-	certCache = cert
 
-	config := &tls.Config{
-		MinVersion:     tls.VersionTLS11,
-		GetCertificate: getCert,
+	if renewer != nil {
+		go renewer()
 	}
 
-	go certUpgrader()
-
 	return config, nil
 }
 
-func certUpgrader() {
+// certUpgrader renews the self signed certificate before it expires
+func certUpgrader(ca *localCA, hosts []string) {
 	renewalTicker := time.NewTicker(renewInterval)
 
 	for {
@@ -74,7 +109,7 @@ func certUpgrader() {
 		certCacheLock.Lock()
 		timeLeft := certCache.Leaf.NotAfter.Sub(time.Now())
 		if timeLeft < renewDurationBefore {
-			cert, err := genCertPair()
+			cert, err := ca.issue(hosts)
 			if err != nil {
 				log.Errorf("something went wrong generating new self signed certificates: %v", err)
 			} else {
@@ -90,39 +125,3 @@ func getCert(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	defer certCacheLock.Unlock()
 	return certCache, nil
 }
-
-// GenCertPair generates an in memory certificate pair
-func genCertPair() (*tls.Certificate, error) {
-	now := time.Now()
-	template := &x509.Certificate{
-		SerialNumber: big.NewInt(now.Unix()),
-		Subject: pkix.Name{
-			Organization: []string{"zedis self-signed"},
-		},
-		NotBefore:             now.Add(-24 * time.Hour), // 1 day ago, in case of clock drift.
-		NotAfter:              now.Add(certLifespan),
-		SubjectKeyId:          []byte("zedis"),
-		BasicConstraintsValid: true,
-		IsCA:        true,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		KeyUsage: x509.KeyUsageKeyEncipherment |
-			x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-	}
-
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return nil, err
-	}
-
-	cert, err := x509.CreateCertificate(rand.Reader, template, template,
-		priv.Public(), priv)
-	if err != nil {
-		return nil, err
-	}
-
-	var outCert tls.Certificate
-	outCert.Certificate = append(outCert.Certificate, cert)
-	outCert.PrivateKey = priv
-
-	return &outCert, nil
-}
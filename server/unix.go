@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tidwall/redcon"
+)
+
+// listenAndServeUnix serves Redis over a Unix socket
+func listenAndServeUnix(listener, path string, perm os.FileMode) error {
+	ln, err := listenUnix(path, perm)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Redis Unix socket interface %s listening at %s", listener, path)
+	defer log.Infof("Redis Unix socket interface %s closed", listener)
+	return redcon.Serve(ln, handler, accept(listener), closed(listener))
+}
+
+// listenUnix listens on a Unix socket
+// a socket left behind by a previous run is replaced
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	err := removeStaleSocket(path)
+	if err != nil {
+		return nil, err
+	}
+	return listenUnixSocket(path, perm)
+}
+
+// time given to a process listening on an existing socket to accept a connection
+const staleSocketTimeout = time.Second
+
+// removeStaleSocket removes the Unix socket at path, if any
+// other files, and sockets another process is listening on, are never removed
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("unix_socket %s exists and is not a socket", path)
+	}
+	conn, err := net.DialTimeout("unix", path, staleSocketTimeout)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("unix_socket %s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
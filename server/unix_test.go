@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/redcon"
+)
+
+func TestListenAndServeUnix(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "zedis-unix")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "zedis.sock")
+
+	// a socket left behind is replaced, other files are kept
+	assert.NoError(ioutil.WriteFile(path, nil, 0600))
+	assert.Error(listenAndServeUnix("unix", path, 0770), "not a socket")
+	assert.NoError(os.Remove(path))
+	stale, err := net.Listen("unix", path)
+	if !assert.NoError(err) {
+		return
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	// a socket another process listens on is kept
+	live, err := net.Listen("unix", filepath.Join(dir, "live.sock"))
+	if !assert.NoError(err) {
+		return
+	}
+	defer live.Close()
+	assert.Error(listenAndServeUnix("unix", filepath.Join(dir, "live.sock"), 0770), "in use")
+	_, err = os.Stat(filepath.Join(dir, "live.sock"))
+	assert.NoError(err)
+
+	go listenAndServeUnix("unix", path, 0770)
+	var conn net.Conn
+	for i := 0; i < 100; i++ {
+		conn, err = net.Dial("unix", path)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	info, err := os.Stat(path)
+	if assert.NoError(err) {
+		assert.Equal(os.FileMode(0770), info.Mode().Perm())
+	}
+
+	_, err = conn.Write([]byte("PING\r\n"))
+	assert.NoError(err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("+PONG\r\n", line)
+}
+
+func TestUnixSocketAuthCommands(t *testing.T) {
+	assert := assert.New(t)
+	defer setZConfig(zConfig())
+	cfg := *zConfig()
+	setZConfig(&cfg)
+
+	set := redcon.Command{Args: [][]byte{[]byte("SET"), []byte("key"), []byte("value")}}
+	conn := new(stubConn)
+	defer removeClient(conn)
+	getClient(conn).listener = "unix"
+	assert.False(authorized(conn, commands["set"], set), "auth_commands is used when not set")
+
+	cfg.UnixSocketAuthCommands = map[string]struct{}{}
+	assert.True(authorized(conn, commands["set"], set), "trusted local channel")
+
+	getClient(conn).listener = "plain"
+	assert.False(authorized(conn, commands["set"], set), "other listeners")
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// listenUnixSocket listens on a new Unix socket with the given permissions
+// the umask decides the permissions when perm is 0
+func listenUnixSocket(path string, perm os.FileMode) (net.Listener, error) {
+	// the socket is only accessible by its owner until its permissions are set,
+	// so it can't be connected to in between
+	umaskLock.Lock()
+	umask := syscall.Umask(0177)
+	ln, err := net.Listen("unix", path)
+	syscall.Umask(umask)
+	umaskLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if perm == 0 {
+		perm = 0777 &^ os.FileMode(umask)
+	}
+	err = os.Chmod(path, perm)
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set the permissions of unix socket %s: %v", path, err)
+	}
+	return ln, nil
+}
+
+// guards changing the process' umask
+var umaskLock sync.Mutex
@@ -0,0 +1,17 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// listenUnixSocket listens on a new Unix socket
+// Windows has no umask nor file modes, so the socket gets the permissions
+// of its directory and setting them is refused
+func listenUnixSocket(path string, perm os.FileMode) (net.Listener, error) {
+	if perm != 0 {
+		return nil, fmt.Errorf("permissions of unix socket %s can't be set on windows", path)
+	}
+	return net.Listen("unix", path)
+}
@@ -1,7 +1,10 @@
 package stor
 
 import (
+	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/zero-os/0-stor/client"
@@ -11,20 +14,33 @@ import (
 // package Errors
 var (
 	ErrNilStorClient = errors.New("Stor client was nil")
+	// ErrTimeout is returned when the deadline of the context passed before the 0-stor replied
+	ErrTimeout = errors.New("0-stor call timed out")
+	// ErrBusy is returned instead of making a call while too many timed out calls are still running
+	ErrBusy = errors.New("too many timed out 0-stor calls still running")
 )
 
+// maximum amount of timed out calls of a client still running,
+// before new calls are refused with ErrBusy
+var maxAbandonedCalls int64 = 64
+
 // Client defines the 0-stor client
+// calls return when the context is done, with ErrTimeout when its deadline passed
 type Client interface {
 	Close()
-	Read(key []byte) ([]byte, error)
-	Write(key []byte, value []byte) error
-	KeyExists(key []byte) (bool, error)
+	Read(ctx context.Context, key []byte) ([]byte, error)
+	Write(ctx context.Context, key []byte, value []byte) error
+	KeyExists(ctx context.Context, key []byte) (bool, error)
 }
 
 // StorClient implementation
 type storClient struct {
 	policy client.Policy
 	client *client.Client
+	calls  abandonedCalls
+	// writes of a key are made one at a time,
+	// so a timed out write still running can't overwrite a later one
+	writes keyLocks
 }
 
 // NewStor creates a new store connection
@@ -48,26 +64,43 @@ func (sc *storClient) Close() {
 }
 
 // Read reads from the stor
-func (sc *storClient) Read(key []byte) ([]byte, error) {
+func (sc *storClient) Read(ctx context.Context, key []byte) ([]byte, error) {
 	log.Debug("Reading from 0-stor...")
 	defer log.Debug("Done reading from the 0-stor")
-	val, _, err := sc.client.Read(key)
-	return val, err
+	var val []byte
+	err := sc.calls.run(ctx, func() error {
+		var err error
+		val, _, err = sc.client.Read(key)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
 }
 
 // Write writes to the stor
-func (sc *storClient) Write(key []byte, value []byte) error {
+func (sc *storClient) Write(ctx context.Context, key []byte, value []byte) error {
 	log.Debug("Writing to 0-stor...")
 	defer log.Debug("Done writing to the 0-stor")
-	_, err := sc.client.Write(key, value, nil)
-	return err
+	unlock, err := sc.writes.lock(ctx, key)
+	if err != nil {
+		return err
+	}
+	return sc.calls.run(ctx, func() error {
+		_, err := sc.client.Write(key, value, nil)
+		return err
+	}, unlock)
 }
 
-func (sc *storClient) KeyExists(key []byte) (bool, error) {
+func (sc *storClient) KeyExists(ctx context.Context, key []byte) (bool, error) {
 	log.Debug("Checking if key is in the 0-stor...")
 	defer log.Debug("Done checking the 0-stor")
 
-	_, err := sc.client.GetMeta(key)
+	err := sc.calls.run(ctx, func() error {
+		_, err := sc.client.GetMeta(key)
+		return err
+	}, nil)
 
 	if err != nil {
 		if err != meta.ErrMetadataNotFound {
@@ -78,3 +111,99 @@ func (sc *storClient) KeyExists(key []byte) (bool, error) {
 
 	return true, nil
 }
+
+// abandonedCalls counts the calls still running after the context of their caller was done
+type abandonedCalls struct {
+	n int64
+}
+
+// run runs a 0-stor call until it returns or the context is done
+// the 0-stor client can't cancel calls, so a call still running when the context is done
+// is left to finish in the background, up to maxAbandonedCalls at a time
+// done, if not nil, is called once the call returned, or right away when it isn't made
+func (a *abandonedCalls) run(ctx context.Context, call func() error, done func()) error {
+	if done == nil {
+		done = func() {}
+	}
+	if err := ctx.Err(); err != nil {
+		done()
+		return contextErr(err)
+	}
+	if atomic.LoadInt64(&a.n) >= maxAbandonedCalls {
+		done()
+		return ErrBusy
+	}
+	result := make(chan error, 1)
+	go func() {
+		defer done()
+		result <- call()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		atomic.AddInt64(&a.n, 1)
+		go func() {
+			<-result
+			atomic.AddInt64(&a.n, -1)
+		}()
+		return contextErr(ctx.Err())
+	}
+}
+
+// keyLocks locks keys, so calls for the same key are made one at a time
+type keyLocks struct {
+	keysLock sync.Mutex
+	keys     map[string]*keyLock
+}
+
+type keyLock struct {
+	// holds a value while locked
+	held chan struct{}
+	// calls holding or waiting for the lock
+	refs int
+}
+
+// lock waits until no other call holds the lock of a key, or the context is done
+// the returned func releases the lock
+func (kl *keyLocks) lock(ctx context.Context, key []byte) (func(), error) {
+	kl.keysLock.Lock()
+	if kl.keys == nil {
+		kl.keys = make(map[string]*keyLock)
+	}
+	l, ok := kl.keys[string(key)]
+	if !ok {
+		l = &keyLock{held: make(chan struct{}, 1)}
+		kl.keys[string(key)] = l
+	}
+	l.refs++
+	kl.keysLock.Unlock()
+
+	select {
+	case l.held <- struct{}{}:
+		return func() {
+			<-l.held
+			kl.release(string(key), l)
+		}, nil
+	case <-ctx.Done():
+		kl.release(string(key), l)
+		return nil, contextErr(ctx.Err())
+	}
+}
+
+func (kl *keyLocks) release(key string, l *keyLock) {
+	kl.keysLock.Lock()
+	defer kl.keysLock.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(kl.keys, key)
+	}
+}
+
+// contextErr returns ErrTimeout for a context that passed its deadline
+func contextErr(err error) error {
+	if err == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return err
+}
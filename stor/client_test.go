@@ -0,0 +1,112 @@
+package stor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+	var calls abandonedCalls
+
+	errCall := errors.New("call failed")
+	assert.Equal(errCall, calls.run(context.Background(), func() error {
+		return errCall
+	}, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	done := make(chan struct{})
+	assert.Equal(ErrTimeout, calls.run(ctx, func() error {
+		<-release
+		return nil
+	}, func() { close(done) }), "hanging call")
+	select {
+	case <-done:
+		t.Error("done is called before the abandoned call returned")
+	default:
+	}
+	close(release)
+	<-done
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	called, finished := false, false
+	assert.Equal(context.Canceled, calls.run(ctx, func() error {
+		called = true
+		return nil
+	}, func() { finished = true }))
+	assert.False(called, "calls aren't made once the context is done")
+	assert.True(finished)
+}
+
+func TestAbandonedCallsLimit(t *testing.T) {
+	assert := assert.New(t)
+	defer func(max int64) { maxAbandonedCalls = max }(maxAbandonedCalls)
+	maxAbandonedCalls = 1
+	var calls abandonedCalls
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	assert.Equal(ErrTimeout, calls.run(ctx, func() error {
+		<-release
+		return nil
+	}, nil))
+
+	// calls are refused while too many timed out calls are still running
+	called := false
+	assert.Equal(ErrBusy, calls.run(context.Background(), func() error {
+		called = true
+		return nil
+	}, nil))
+	assert.False(called)
+
+	close(release)
+	for i := 0; i < 100 && calls.run(context.Background(), func() error { return nil }, nil) == ErrBusy; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(calls.run(context.Background(), func() error { return nil }, nil))
+}
+
+func TestKeyLocks(t *testing.T) {
+	assert := assert.New(t)
+	var locks keyLocks
+
+	unlock, err := locks.lock(context.Background(), []byte("a"))
+	if !assert.NoError(err) {
+		return
+	}
+	// other keys aren't locked
+	unlockB, err := locks.lock(context.Background(), []byte("b"))
+	if assert.NoError(err) {
+		unlockB()
+	}
+
+	// a call for the same key waits until the lock is released, or its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = locks.lock(ctx, []byte("a"))
+	assert.Equal(ErrTimeout, err)
+
+	locked := make(chan func())
+	go func() {
+		unlock, err := locks.lock(context.Background(), []byte("a"))
+		assert.NoError(err)
+		locked <- unlock
+	}()
+	select {
+	case <-locked:
+		t.Error("the key is locked twice")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlock()
+	(<-locked)()
+
+	assert.Empty(locks.keys, "released locks are removed")
+}
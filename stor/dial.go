@@ -0,0 +1,51 @@
+package stor
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zero-os/0-stor/client"
+)
+
+// ShardStatus is the reachability of a 0-stor data shard or etcd meta shard
+type ShardStatus struct {
+	// data or meta
+	Kind    string
+	Address string
+	// nil when the shard accepted a TCP connection
+	Err error
+}
+
+// DialShards checks if the data and meta shards of a policy accept TCP connections
+func DialShards(policy client.Policy, timeout time.Duration) []ShardStatus {
+	statuses := make([]ShardStatus, 0, len(policy.DataShards)+len(policy.MetaShards))
+	for _, addr := range policy.DataShards {
+		statuses = append(statuses, ShardStatus{Kind: "data", Address: addr, Err: dial(addr, timeout)})
+	}
+	for _, addr := range policy.MetaShards {
+		statuses = append(statuses, ShardStatus{Kind: "meta", Address: addr, Err: dial(metaHost(addr), timeout)})
+	}
+	return statuses
+}
+
+func dial(addr string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// metaHost returns the host:port of an etcd endpoint, which can be a URL
+func metaHost(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return u.Host
+}
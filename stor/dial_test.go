@@ -0,0 +1,38 @@
+package stor
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-os/0-stor/client"
+)
+
+func TestDialShards(t *testing.T) {
+	assert := assert.New(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	addr := l.Addr().String()
+	// a closed listener's port refuses connections
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+	defer l.Close()
+
+	statuses := DialShards(client.Policy{
+		DataShards: []string{addr, closedAddr},
+		MetaShards: []string{"http://" + addr},
+	}, time.Second)
+	if assert.Len(statuses, 3) {
+		assert.Equal(ShardStatus{Kind: "data", Address: addr}, statuses[0])
+		assert.Equal(closedAddr, statuses[1].Address)
+		assert.Error(statuses[1].Err)
+		assert.Equal(ShardStatus{Kind: "meta", Address: "http://" + addr}, statuses[2])
+	}
+}